@@ -0,0 +1,140 @@
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var ErrNotFound = errors.New("snapshot not found")
+
+// Store keeps gzip compressed snapshots on disk, addressed by the SHA-256 of
+// their uncompressed content, so that unchanged pages are stored once.
+type Store struct {
+	dir string
+}
+
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir}, nil
+}
+
+// Put stores content unless it is already there and returns its digest.
+func (s *Store) Put(content []byte) (string, error) {
+	sum := sha256.Sum256(content)
+	digest := hex.EncodeToString(sum[:])
+	target := s.path(digest)
+	if _, err := os.Stat(target); err == nil {
+		// Touch it, Prune goes by when a snapshot was last stored.
+		now := time.Now()
+		return digest, os.Chtimes(target, now, now)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o750); err != nil {
+		return "", err
+	}
+
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	if _, err := writer.Write(content); err != nil {
+		return "", err
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+
+	// Write next to the target and rename, so readers never see a partial
+	// snapshot.
+	temporary, err := os.CreateTemp(filepath.Dir(target), digest+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(temporary.Name())
+	if _, err := temporary.Write(compressed.Bytes()); err != nil {
+		_ = temporary.Close()
+		return "", err
+	}
+	if err := temporary.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(temporary.Name(), target); err != nil {
+		return "", err
+	}
+	return digest, nil
+}
+
+// Compressed returns the stored, gzip compressed snapshot.
+func (s *Store) Compressed(digest string) ([]byte, error) {
+	if !validDigest(digest) {
+		return nil, ErrNotFound
+	}
+	content, err := os.ReadFile(s.path(digest))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return content, err
+}
+
+// Get returns the uncompressed snapshot.
+func (s *Store) Get(digest string) ([]byte, error) {
+	compressed, err := s.Compressed(digest)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, fmt.Errorf("corrupt snapshot %s: %w", digest, err)
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// Prune removes the snapshots that keep rejects and that were last stored
+// before cutoff, and returns how many it removed. The cutoff protects
+// snapshots stored by a Put whose caller has not recorded the digest yet.
+func (s *Store) Prune(keep func(digest string) bool, cutoff time.Time) (int, error) {
+	removed := 0
+	err := filepath.WalkDir(s.dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		digest, isSnapshot := strings.CutSuffix(entry.Name(), ".gz")
+		if entry.IsDir() || !isSnapshot || !validDigest(digest) || keep(digest) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if !info.ModTime().Before(cutoff) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		removed++
+		return nil
+	})
+	return removed, err
+}
+
+// path spreads snapshots over directories named after the first two digits
+// of their digest.
+func (s *Store) path(digest string) string {
+	return filepath.Join(s.dir, digest[:2], digest+".gz")
+}
+
+func validDigest(digest string) bool {
+	decoded, err := hex.DecodeString(digest)
+	return err == nil && len(decoded) == sha256.Size
+}
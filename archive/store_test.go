@@ -0,0 +1,82 @@
+package archive
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPutAndGet(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	digest, err := store.Put([]byte("<html>snapshot</html>"))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	content, err := store.Get(digest)
+
+	if err != nil || string(content) != "<html>snapshot</html>" {
+		t.Errorf("Expected stored snapshot, got %q (%v)", content, err)
+	}
+}
+
+func TestPutStoresIdenticalContentOnce(t *testing.T) {
+	dir := t.TempDir()
+	store, _ := NewStore(dir)
+
+	first, _ := store.Put([]byte("same"))
+	second, _ := store.Put([]byte("same"))
+
+	if first != second {
+		t.Errorf("Expected the same digest, got %s and %s", first, second)
+	}
+	entries, _ := os.ReadDir(filepath.Join(dir, first[:2]))
+	if len(entries) != 1 {
+		t.Errorf("Expected a single file, got %d", len(entries))
+	}
+}
+
+func TestGetRejectsInvalidDigests(t *testing.T) {
+	store, _ := NewStore(t.TempDir())
+
+	for _, digest := range []string{"../../etc/passwd", "abc", "00" + string(make([]byte, 62))} {
+		if _, err := store.Get(digest); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound for %q, got %v", digest, err)
+		}
+	}
+}
+
+func TestPruneRemovesOnlyStaleUnreferencedSnapshots(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept, _ := store.Put([]byte("kept"))
+	stale, _ := store.Put([]byte("stale"))
+	fresh, _ := store.Put([]byte("fresh"))
+	old := time.Now().Add(-2 * time.Hour)
+	for _, digest := range []string{kept, stale} {
+		if err := os.Chtimes(store.path(digest), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed, err := store.Prune(func(digest string) bool { return digest == kept }, time.Now().Add(-time.Hour))
+
+	if err != nil || removed != 1 {
+		t.Fatalf("Expected 1 snapshot to be removed, got %d (%v)", removed, err)
+	}
+	if _, err := store.Get(stale); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected the stale snapshot to be gone, got %v", err)
+	}
+	for _, digest := range []string{kept, fresh} {
+		if _, err := store.Get(digest); err != nil {
+			t.Errorf("Expected %s to be kept, got %v", digest, err)
+		}
+	}
+}
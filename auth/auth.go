@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+)
+
+const ApiKeyHeader = "X-API-Key"
+
+const (
+	ScopeLinksRead     = "links:read"
+	ScopeLinksWrite    = "links:write"
+	ScopeStatsRead     = "stats:read"
+	ScopeWebhooksRead  = "webhooks:read"
+	ScopeWebhooksWrite = "webhooks:write"
+	ScopeEventsRead    = "events:read"
+)
+
+var ErrInvalidKey = errors.New("invalid API key")
+
+// Key is an API key as stored at rest. Only the SHA-256 hash of the raw key
+// is kept, hex encoded.
+type Key struct {
+	Id     string   `json:"id"`
+	Owner  string   `json:"owner"`
+	Hash   string   `json:"hash"`
+	Scopes []string `json:"scopes"`
+}
+
+type Principal struct {
+	KeyId  string
+	Owner  string
+	Scopes []string
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	return p != nil && slices.Contains(p.Scopes, scope)
+}
+
+type Authenticator struct {
+	keys map[string]Key
+}
+
+func New(keys []Key) (*Authenticator, error) {
+	byHash := make(map[string]Key, len(keys))
+	for _, key := range keys {
+		hash := strings.ToLower(key.Hash)
+		if _, err := hex.DecodeString(hash); err != nil || len(hash) != 2*sha256.Size {
+			return nil, fmt.Errorf("key %q does not have a valid sha256 hash", key.Id)
+		}
+		byHash[hash] = key
+	}
+	return &Authenticator{keys: byHash}, nil
+}
+
+// LoadKeys reads a JSON array of keys from filePath.
+func LoadKeys(filePath string) (*Authenticator, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	var keys []Key
+	if err := json.Unmarshal(content, &keys); err != nil {
+		return nil, fmt.Errorf("failed to parse API keys: %w", err)
+	}
+	return New(keys)
+}
+
+func HashKey(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+func (a *Authenticator) Authenticate(raw string) (*Principal, error) {
+	key, exists := a.keys[HashKey(raw)]
+	if raw == "" || !exists {
+		return nil, ErrInvalidKey
+	}
+	return &Principal{KeyId: key.Id, Owner: key.Owner, Scopes: key.Scopes}, nil
+}
+
+// Require only lets requests through that present a key with the given scope.
+// A nil Authenticator means authentication is disabled.
+func (a *Authenticator) Require(scope string, next http.HandlerFunc) http.HandlerFunc {
+	if a == nil {
+		return next
+	}
+	return func(writer http.ResponseWriter, r *http.Request) {
+		principal, err := a.Authenticate(KeyFromRequest(r))
+		if err != nil {
+			writer.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+			http.Error(writer, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !principal.HasScope(scope) {
+			http.Error(writer, fmt.Sprintf("Missing scope %s", scope), http.StatusForbidden)
+			return
+		}
+		next(writer, r.WithContext(WithPrincipal(r.Context(), principal)))
+	}
+}
+
+// KeyFromRequest returns the raw key from the X-API-Key header or a bearer
+// Authorization header.
+func KeyFromRequest(r *http.Request) string {
+	if key := r.Header.Get(ApiKeyHeader); key != "" {
+		return key
+	}
+	if token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); found {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+func PrincipalFrom(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(principalKey{}).(*Principal)
+	return principal
+}
+
+// OwnerFrom returns the owner the caller acts for: the owner of its key, or
+// the key itself when no owner is set. It is empty while authentication is
+// disabled.
+func OwnerFrom(ctx context.Context) string {
+	principal := PrincipalFrom(ctx)
+	if principal == nil {
+		return ""
+	}
+	if principal.Owner != "" {
+		return principal.Owner
+	}
+	return principal.KeyId
+}
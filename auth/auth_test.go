@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestAuthenticator(t *testing.T) *Authenticator {
+	authenticator, err := New([]Key{
+		{Id: "writer", Owner: "team-a", Hash: HashKey("write-key"), Scopes: []string{ScopeLinksWrite}},
+		{Id: "reader", Owner: "team-b", Hash: HashKey("read-key"), Scopes: []string{ScopeStatsRead}},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return authenticator
+}
+
+func TestNewRejectsInvalidHash(t *testing.T) {
+	_, err := New([]Key{{Id: "broken", Hash: "plaintext"}})
+	if err == nil {
+		t.Errorf("Expected error for non-sha256 hash, got nil")
+	}
+}
+
+func TestAuthenticateReturnsPrincipalForKnownKey(t *testing.T) {
+	authenticator := newTestAuthenticator(t)
+
+	principal, err := authenticator.Authenticate("write-key")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if principal.KeyId != "writer" || principal.Owner != "team-a" {
+		t.Errorf("Expected writer principal of team-a, got %+v", principal)
+	}
+}
+
+func TestAuthenticateRejectsUnknownKey(t *testing.T) {
+	authenticator := newTestAuthenticator(t)
+
+	if _, err := authenticator.Authenticate("guess"); err != ErrInvalidKey {
+		t.Errorf("Expected ErrInvalidKey, got %v", err)
+	}
+}
+
+func TestRequireRejectsMissingKey(t *testing.T) {
+	authenticator := newTestAuthenticator(t)
+	handler := authenticator.Require(ScopeLinksWrite, func(writer http.ResponseWriter, r *http.Request) {})
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodPost, "/", nil))
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401, got %d", w.Code)
+	}
+}
+
+func TestRequireRejectsMissingScope(t *testing.T) {
+	authenticator := newTestAuthenticator(t)
+	handler := authenticator.Require(ScopeLinksWrite, func(writer http.ResponseWriter, r *http.Request) {})
+
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set(ApiKeyHeader, "read-key")
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403, got %d", w.Code)
+	}
+}
+
+func TestRequirePutsPrincipalInContext(t *testing.T) {
+	authenticator := newTestAuthenticator(t)
+	var principal *Principal
+	handler := authenticator.Require(ScopeLinksWrite, func(writer http.ResponseWriter, r *http.Request) {
+		principal = PrincipalFrom(r.Context())
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set("Authorization", "Bearer write-key")
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+	if principal == nil || principal.KeyId != "writer" {
+		t.Errorf("Expected writer principal in context, got %+v", principal)
+	}
+}
+
+func TestRequireOnNilAuthenticatorIsOpen(t *testing.T) {
+	var authenticator *Authenticator
+	called := false
+	handler := authenticator.Require(ScopeLinksWrite, func(writer http.ResponseWriter, r *http.Request) { called = true })
+
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+
+	if !called {
+		t.Errorf("Expected handler to be called when authentication is disabled")
+	}
+}
+
+func TestLoadKeysReadsJsonFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	content := `[{"id":"ci","owner":"team-a","hash":"` + HashKey("secret") + `","scopes":["links:write"]}]`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write keys file: %v", err)
+	}
+
+	authenticator, err := LoadKeys(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := authenticator.Authenticate("secret"); err != nil {
+		t.Errorf("Expected key from file to authenticate, got %v", err)
+	}
+}
+
+func TestOwnerFromFallsBackToKeyId(t *testing.T) {
+	ctx := context.Background()
+	if owner := OwnerFrom(ctx); owner != "" {
+		t.Errorf("Expected no owner without principal, got %q", owner)
+	}
+	if owner := OwnerFrom(WithPrincipal(ctx, &Principal{KeyId: "key", Owner: "team-a"})); owner != "team-a" {
+		t.Errorf("Expected owner 'team-a', got %q", owner)
+	}
+	if owner := OwnerFrom(WithPrincipal(ctx, &Principal{KeyId: "key"})); owner != "key" {
+		t.Errorf("Expected key id as owner, got %q", owner)
+	}
+}
@@ -0,0 +1,225 @@
+package domainpolicy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+var (
+	ErrBlocked    = errors.New("destination domain is blocked")
+	ErrNotAllowed = errors.New("destination domain is not allowed")
+)
+
+// Policy decides which destination domains links may point to. Hosts matching
+// the blocklist are refused, and when an allowlist is configured only hosts
+// matching it are accepted. A nil Policy accepts every host.
+//
+// Rule files hold one rule per line, blank lines and lines starting with #
+// being ignored:
+//
+//	example.com      the domain itself
+//	.example.com     the domain and all of its subdomains
+//	*.example.com    wildcard, * matches any run of characters
+//	/^ex\d+\.com$/   regular expression matched against the host
+type Policy struct {
+	blocklistFile string
+	allowlistFile string
+	rules         atomic.Pointer[rules]
+}
+
+type rules struct {
+	blocklist *ruleList
+	allowlist *ruleList
+}
+
+type ruleList struct {
+	exact    map[string]struct{}
+	suffixes []string
+	patterns []*regexp.Regexp
+}
+
+// Load reads the blocklist and allowlist files, either of which may be empty.
+// It returns nil when neither is configured.
+func Load(blocklistFile string, allowlistFile string) (*Policy, error) {
+	if blocklistFile == "" && allowlistFile == "" {
+		return nil, nil
+	}
+	p := &Policy{blocklistFile: blocklistFile, allowlistFile: allowlistFile}
+	if err := p.Reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Reload reads the rule files again. The previous rules stay in place when
+// either file cannot be read or parsed.
+func (p *Policy) Reload() error {
+	blocklist, err := loadRuleList(p.blocklistFile)
+	if err != nil {
+		return err
+	}
+	allowlist, err := loadRuleList(p.allowlistFile)
+	if err != nil {
+		return err
+	}
+	p.rules.Store(&rules{blocklist: blocklist, allowlist: allowlist})
+	return nil
+}
+
+func loadRuleList(filePath string) (*ruleList, error) {
+	if filePath == "" {
+		return nil, nil
+	}
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	list, err := parseRuleList(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filePath, err)
+	}
+	return list, nil
+}
+
+func parseRuleList(content []byte) (*ruleList, error) {
+	list := &ruleList{exact: make(map[string]struct{})}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for line := 1; scanner.Scan(); line++ {
+		rule := strings.TrimSpace(scanner.Text())
+		switch {
+		case rule == "" || strings.HasPrefix(rule, "#"):
+		case len(rule) > 2 && strings.HasPrefix(rule, "/") && strings.HasSuffix(rule, "/"):
+			pattern, err := regexp.Compile(rule[1 : len(rule)-1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			list.patterns = append(list.patterns, pattern)
+		case strings.Contains(rule, "*"):
+			glob := regexp.QuoteMeta(normalizeHost(rule))
+			list.patterns = append(list.patterns, regexp.MustCompile("^"+strings.ReplaceAll(glob, `\*`, ".*")+"$"))
+		case strings.HasPrefix(rule, "."):
+			list.suffixes = append(list.suffixes, normalizeHost(rule))
+		default:
+			list.exact[normalizeHost(rule)] = struct{}{}
+		}
+	}
+	return list, scanner.Err()
+}
+
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+func (l *ruleList) matches(host string) bool {
+	if _, exists := l.exact[host]; exists {
+		return true
+	}
+	for _, suffix := range l.suffixes {
+		if host == suffix[1:] || strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+	for _, pattern := range l.patterns {
+		if pattern.MatchString(host) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check returns ErrBlocked or ErrNotAllowed when host may not be linked to.
+func (p *Policy) Check(host string) error {
+	if p == nil {
+		return nil
+	}
+	host = normalizeHost(host)
+	current := p.rules.Load()
+	if current.blocklist != nil && current.blocklist.matches(host) {
+		return ErrBlocked
+	}
+	if current.allowlist != nil && !current.allowlist.matches(host) {
+		return ErrNotAllowed
+	}
+	return nil
+}
+
+// CheckUrl checks the host of an absolute URL. URLs without a host, such as
+// custom app schemes, are accepted.
+func (p *Policy) CheckUrl(raw string) error {
+	if p == nil {
+		return nil
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if parsed.Host == "" {
+		return nil
+	}
+	return p.Check(parsed.Hostname())
+}
+
+// Watch reloads the rules whenever one of the files changes, until ctx is
+// done. The directories are watched rather than the files so that editors
+// replacing a file by renaming over it are picked up as well.
+func (p *Policy) Watch(ctx context.Context, logger zerolog.Logger) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	files := make(map[string]bool)
+	for _, filePath := range []string{p.blocklistFile, p.allowlistFile} {
+		if filePath == "" {
+			continue
+		}
+		absolute, err := filepath.Abs(filePath)
+		if err != nil {
+			_ = watcher.Close()
+			return err
+		}
+		files[absolute] = true
+		if err := watcher.Add(filepath.Dir(absolute)); err != nil {
+			_ = watcher.Close()
+			return err
+		}
+	}
+
+	go func() {
+		defer watcher.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if !files[filepath.Clean(event.Name)] || event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+					continue
+				}
+				if err := p.Reload(); err != nil {
+					logger.Error().Err(err).Msg("Failed to reload domain rules, keeping the previous ones")
+					continue
+				}
+				logger.Info().Str("file", event.Name).Msg("Reloaded domain rules")
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logger.Error().Err(err).Msg("Failed to watch domain rules")
+			}
+		}
+	}()
+	return nil
+}
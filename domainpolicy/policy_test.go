@@ -0,0 +1,115 @@
+package domainpolicy
+
+import (
+	"context"
+	"errors"
+	"github.com/rs/zerolog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeRules(t *testing.T, filePath string, content string) {
+	t.Helper()
+	if err := os.WriteFile(filePath, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckMatchesEveryRuleKind(t *testing.T) {
+	blocklist := filepath.Join(t.TempDir(), "blocklist.txt")
+	writeRules(t, blocklist, "# phishing\nevil.com\n.bad.org\n*.tracker.net\n/^login-[a-z]+\\.io$/\n")
+	policy, err := Load(blocklist, "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	cases := map[string]bool{
+		"evil.com":          true,
+		"EVIL.com.":         true,
+		"www.evil.com":      false,
+		"bad.org":           true,
+		"deep.sub.bad.org":  true,
+		"notbad.org":        false,
+		"a.b.tracker.net":   true,
+		"tracker.net":       false,
+		"login-bank.io":     true,
+		"login-bank.io.com": false,
+		"example.com":       false,
+	}
+	for host, blocked := range cases {
+		err := policy.Check(host)
+
+		if errors.Is(err, ErrBlocked) != blocked {
+			t.Errorf("Expected blocked=%v for %s, got %v", blocked, host, err)
+		}
+	}
+}
+
+func TestCheckOnlyAcceptsAllowlistedHosts(t *testing.T) {
+	dir := t.TempDir()
+	writeRules(t, filepath.Join(dir, "allow.txt"), ".example.com\n")
+	writeRules(t, filepath.Join(dir, "block.txt"), "private.example.com\n")
+	policy, err := Load(filepath.Join(dir, "block.txt"), filepath.Join(dir, "allow.txt"))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if err := policy.Check("docs.example.com"); err != nil {
+		t.Errorf("Expected allowlisted host to pass, got %v", err)
+	}
+	if err := policy.Check("other.org"); !errors.Is(err, ErrNotAllowed) {
+		t.Errorf("Expected ErrNotAllowed, got %v", err)
+	}
+	if err := policy.Check("private.example.com"); !errors.Is(err, ErrBlocked) {
+		t.Errorf("Expected blocklist to win over allowlist, got %v", err)
+	}
+}
+
+func TestNilPolicyAcceptsEverything(t *testing.T) {
+	policy, err := Load("", "")
+	if err != nil || policy != nil {
+		t.Fatalf("Expected no policy without files, got %v %v", policy, err)
+	}
+
+	if err := policy.CheckUrl("https://evil.com"); err != nil {
+		t.Errorf("Expected nil policy to accept, got %v", err)
+	}
+}
+
+func TestReloadKeepsRulesOnInvalidFile(t *testing.T) {
+	blocklist := filepath.Join(t.TempDir(), "blocklist.txt")
+	writeRules(t, blocklist, "evil.com\n")
+	policy, _ := Load(blocklist, "")
+
+	writeRules(t, blocklist, "/(unclosed/\n")
+	if err := policy.Reload(); err == nil {
+		t.Fatalf("Expected an error for an invalid regular expression")
+	}
+
+	if err := policy.Check("evil.com"); !errors.Is(err, ErrBlocked) {
+		t.Errorf("Expected previous rules to stay in place, got %v", err)
+	}
+}
+
+func TestWatchReloadsChangedFile(t *testing.T) {
+	blocklist := filepath.Join(t.TempDir(), "blocklist.txt")
+	writeRules(t, blocklist, "evil.com\n")
+	policy, _ := Load(blocklist, "")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := policy.Watch(ctx, zerolog.Nop()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	writeRules(t, blocklist, "evil.com\nworse.com\n")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for policy.Check("worse.com") == nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected changed file to be picked up")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,75 @@
+package events
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"time"
+)
+
+const (
+	LinkCreated        = "link.created"
+	LinkDeleted        = "link.deleted"
+	LinkExpired        = "link.expired"
+	LinkVisitThreshold = "link.visit_threshold"
+	// LinkVisited is raised on every redirect. It is only streamed, never
+	// sent to webhooks.
+	LinkVisited = "link.visited"
+)
+
+// Types lists the link lifecycle events, the ones webhooks can subscribe to.
+var Types = []string{LinkCreated, LinkDeleted, LinkExpired, LinkVisitThreshold}
+
+// Link is the part of a link that events carry.
+type Link struct {
+	Id        int      `json:"id"`
+	Shortened string   `json:"shortened"`
+	Url       string   `json:"url"`
+	Original  string   `json:"original"`
+	Owner     string   `json:"owner,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+	Campaign  string   `json:"campaign,omitempty"`
+	Visits    int      `json:"visits"`
+}
+
+type Event struct {
+	Id   string    `json:"id"`
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	Link Link      `json:"link"`
+	// Threshold is the visit count a link.visit_threshold event was raised
+	// for.
+	Threshold int `json:"threshold,omitempty"`
+	// Visit describes the visit of a link.visited event.
+	Visit *Visit `json:"visit,omitempty"`
+}
+
+type Visit struct {
+	Destination string `json:"destination"`
+	// Referrer is the host of the referring page.
+	Referrer string `json:"referrer,omitempty"`
+	Country  string `json:"country,omitempty"`
+	Os       string `json:"os,omitempty"`
+	Device   string `json:"device,omitempty"`
+	Browser  string `json:"browser,omitempty"`
+	Rule     string `json:"rule,omitempty"`
+	Variant  string `json:"variant,omitempty"`
+}
+
+func New(eventType string, link Link) Event {
+	return Event{Id: uuid.NewString(), Type: eventType, Time: time.Now().UTC(), Link: link}
+}
+
+// Publisher hands events on to whoever listens for them. Publish must not
+// block on slow listeners.
+type Publisher interface {
+	Publish(ctx context.Context, event Event)
+}
+
+// Publishers publishes every event to each of its publishers.
+type Publishers []Publisher
+
+func (p Publishers) Publish(ctx context.Context, event Event) {
+	for _, publisher := range p {
+		publisher.Publish(ctx, event)
+	}
+}
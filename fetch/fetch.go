@@ -0,0 +1,246 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultTimeout      = 10 * time.Second
+	defaultMaxBytes     = 1 << 20
+	defaultMaxRedirects = 5
+	userAgent           = "url-shortener-fetch/1.0"
+)
+
+var (
+	ErrTooManyRedirects = errors.New("too many redirects")
+	ErrRedirectLoop     = errors.New("redirect loop")
+	ErrPrivateNetwork   = errors.New("private network addresses are not allowed")
+)
+
+// sharedAddressSpace is the carrier-grade NAT range, which netip does not
+// count as private.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+type Config struct {
+	// Timeout bounds the whole exchange, redirects and body included.
+	Timeout time.Duration
+	// MaxBytes is how much of a body is read, the rest is dropped.
+	MaxBytes     int64
+	MaxRedirects int
+	// AllowPrivateNetworks lets the client connect to loopback, private and
+	// link-local addresses, which it refuses by default so that links cannot
+	// be used to probe the network the shortener runs in.
+	AllowPrivateNetworks bool
+}
+
+// Client fetches pages on behalf of the shortener, never reading more than
+// MaxBytes of a body or following more than MaxRedirects redirects.
+type Client struct {
+	http         *http.Client
+	maxBytes     int64
+	maxRedirects int
+}
+
+type Page struct {
+	// Url is where the page was found after following redirects.
+	Url         string
+	Status      int
+	ContentType string
+	Body        []byte
+	// Truncated is set when the body was longer than MaxBytes.
+	Truncated bool
+}
+
+func New(config Config) *Client {
+	if config.Timeout <= 0 {
+		config.Timeout = defaultTimeout
+	}
+	if config.MaxBytes <= 0 {
+		config.MaxBytes = defaultMaxBytes
+	}
+	if config.MaxRedirects <= 0 {
+		config.MaxRedirects = defaultMaxRedirects
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// Connections go straight to the destination so that the address check
+	// applies to it rather than to a proxy.
+	transport.Proxy = nil
+	if !config.AllowPrivateNetworks {
+		dialer := &net.Dialer{Timeout: config.Timeout, Control: refusePrivateNetworks}
+		transport.DialContext = dialer.DialContext
+	}
+	return &Client{
+		http: &http.Client{
+			Transport: transport,
+			Timeout:   config.Timeout,
+			CheckRedirect: func(_ *http.Request, via []*http.Request) error {
+				if len(via) > config.MaxRedirects {
+					return ErrTooManyRedirects
+				}
+				return nil
+			},
+		},
+		maxBytes:     config.MaxBytes,
+		maxRedirects: config.MaxRedirects,
+	}
+}
+
+// refusePrivateNetworks runs after name resolution, so it sees the address
+// actually connected to and cannot be sidestepped with DNS tricks.
+func refusePrivateNetworks(_ string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if IsPrivate(ip) {
+		return fmt.Errorf("%w: %s", ErrPrivateNetwork, ip)
+	}
+	return nil
+}
+
+// IsPrivate reports whether ip is not a public unicast address.
+func IsPrivate(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || sharedAddressSpace.Contains(ip)
+}
+
+// Get fetches rawUrl. Responses with an error status are returned as pages
+// as well, it is up to the caller what to make of them.
+func (c *Client) Get(ctx context.Context, rawUrl string) (*Page, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml;q=0.9,*/*;q=0.8")
+	response, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", rawUrl, err)
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, c.maxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", rawUrl, err)
+	}
+	page := &Page{
+		Url:         response.Request.URL.String(),
+		Status:      response.StatusCode,
+		ContentType: response.Header.Get("Content-Type"),
+		Body:        body,
+	}
+	if int64(len(body)) > c.maxBytes {
+		page.Body = body[:c.maxBytes]
+		page.Truncated = true
+	}
+	return page, nil
+}
+
+// Do sends req within the client's limits and address checks. Reading and
+// closing the response body is up to the caller.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", userAgent)
+	}
+	return c.http.Do(req)
+}
+
+// DoWithoutRedirects is Do for requests that must not be sent on elsewhere:
+// a redirect is returned as the response.
+func (c *Client) DoWithoutRedirects(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", userAgent)
+	}
+	return c.withoutRedirects().Do(req)
+}
+
+func (c *Client) withoutRedirects() *http.Client {
+	client := *c.http
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	return &client
+}
+
+// Hop is one step of a redirect chain.
+type Hop struct {
+	Url    string `json:"url"`
+	Status int    `json:"status"`
+}
+
+// Resolve follows the redirect chain starting at rawUrl one hop at a time and
+// returns every hop, the last one being where the chain ends. Only http and
+// https redirects are followed.
+func (c *Client) Resolve(ctx context.Context, rawUrl string) ([]Hop, error) {
+	client := c.withoutRedirects()
+	current, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	var hops []Hop
+	visited := make(map[string]bool)
+	for {
+		if visited[current.String()] {
+			return hops, fmt.Errorf("%w at %s", ErrRedirectLoop, current)
+		}
+		visited[current.String()] = true
+
+		status, location, err := c.step(ctx, client, current.String())
+		if err != nil {
+			return hops, err
+		}
+		hops = append(hops, Hop{Url: current.String(), Status: status})
+		if location == "" {
+			return hops, nil
+		}
+		next, err := current.Parse(location)
+		if err != nil || (next.Scheme != "http" && next.Scheme != "https") {
+			return hops, nil
+		}
+		if len(hops) > c.maxRedirects {
+			return hops, ErrTooManyRedirects
+		}
+		current = next
+	}
+}
+
+// step requests rawUrl with HEAD, falling back to GET for servers that do not
+// answer HEAD properly, and returns the status and the redirect location.
+func (c *Client) step(ctx context.Context, client *http.Client, rawUrl string) (int, string, error) {
+	var response *http.Response
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		req, err := http.NewRequestWithContext(ctx, method, rawUrl, nil)
+		if err != nil {
+			return 0, "", err
+		}
+		req.Header.Set("User-Agent", userAgent)
+		response, err = client.Do(req)
+		if err != nil {
+			return 0, "", fmt.Errorf("failed to fetch %s: %w", rawUrl, err)
+		}
+		_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, c.maxBytes))
+		_ = response.Body.Close()
+		if response.StatusCode != http.StatusMethodNotAllowed && response.StatusCode != http.StatusNotImplemented {
+			break
+		}
+	}
+	if response.StatusCode < 300 || response.StatusCode >= 400 {
+		return response.StatusCode, "", nil
+	}
+	return response.StatusCode, response.Header.Get("Location"), nil
+}
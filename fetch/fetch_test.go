@@ -0,0 +1,162 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetFollowsRedirects(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(writer, r, "/new", http.StatusMovedPermanently)
+			return
+		}
+		writer.Header().Set("Content-Type", "text/html")
+		_, _ = writer.Write([]byte("<title>New</title>"))
+	}))
+	defer server.Close()
+
+	page, err := New(Config{AllowPrivateNetworks: true}).Get(context.Background(), server.URL+"/old")
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if page.Url != server.URL+"/new" || page.Status != http.StatusOK || string(page.Body) != "<title>New</title>" {
+		t.Errorf("Expected final page, got %+v", page)
+	}
+}
+
+func TestGetTruncatesLongBodies(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, _ *http.Request) {
+		_, _ = writer.Write([]byte(strings.Repeat("a", 100)))
+	}))
+	defer server.Close()
+
+	page, err := New(Config{MaxBytes: 10, AllowPrivateNetworks: true}).Get(context.Background(), server.URL)
+
+	if err != nil || len(page.Body) != 10 || !page.Truncated {
+		t.Errorf("Expected body truncated to 10 bytes, got %d bytes (%v)", len(page.Body), err)
+	}
+}
+
+func TestGetStopsAfterMaxRedirects(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, r *http.Request) {
+		http.Redirect(writer, r, r.URL.Path+"x", http.StatusFound)
+	}))
+	defer server.Close()
+
+	_, err := New(Config{MaxRedirects: 2, AllowPrivateNetworks: true}).Get(context.Background(), server.URL+"/")
+
+	if !errors.Is(err, ErrTooManyRedirects) {
+		t.Errorf("Expected ErrTooManyRedirects, got %v", err)
+	}
+}
+
+func TestGetTimesOut(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	if _, err := New(Config{Timeout: 50 * time.Millisecond, AllowPrivateNetworks: true}).Get(context.Background(), server.URL); err == nil {
+		t.Errorf("Expected a timeout error")
+	}
+}
+
+func TestGetRefusesPrivateNetworks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer server.Close()
+
+	_, err := New(Config{}).Get(context.Background(), server.URL)
+
+	if !errors.Is(err, ErrPrivateNetwork) {
+		t.Errorf("Expected ErrPrivateNetwork, got %v", err)
+	}
+}
+
+func TestIsPrivate(t *testing.T) {
+	cases := map[string]bool{
+		"127.0.0.1":       true,
+		"10.1.2.3":        true,
+		"169.254.169.254": true,
+		"100.64.0.1":      true,
+		"::1":             true,
+		"::ffff:10.0.0.1": true,
+		"fd00::1":         true,
+		"0.0.0.0":         true,
+		"93.184.216.34":   false,
+		"2606:4700::1111": false,
+	}
+	for address, expected := range cases {
+		if result := IsPrivate(netip.MustParseAddr(address)); result != expected {
+			t.Errorf("Expected %v for %s, got %v", expected, address, result)
+		}
+	}
+}
+
+func TestResolveRecordsEveryHop(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/track":
+			if r.Method == http.MethodHead {
+				writer.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			http.Redirect(writer, r, "/next?id=1", http.StatusFound)
+		case "/next":
+			http.Redirect(writer, r, "/final", http.StatusMovedPermanently)
+		}
+	}))
+	defer server.Close()
+
+	hops, err := New(Config{AllowPrivateNetworks: true}).Resolve(context.Background(), server.URL+"/track")
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := []Hop{{server.URL + "/track", http.StatusFound}, {server.URL + "/next?id=1", http.StatusMovedPermanently}, {server.URL + "/final", http.StatusOK}}
+	if len(hops) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, hops)
+	}
+	for i := range expected {
+		if hops[i] != expected[i] {
+			t.Errorf("Expected hop %d to be %v, got %v", i, expected[i], hops[i])
+		}
+	}
+}
+
+func TestResolveDetectsLoops(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, r *http.Request) {
+		target := "/a"
+		if r.URL.Path == "/a" {
+			target = "/b"
+		}
+		http.Redirect(writer, r, target, http.StatusFound)
+	}))
+	defer server.Close()
+
+	_, err := New(Config{AllowPrivateNetworks: true}).Resolve(context.Background(), server.URL+"/a")
+
+	if !errors.Is(err, ErrRedirectLoop) {
+		t.Errorf("Expected ErrRedirectLoop, got %v", err)
+	}
+}
+
+func TestResolveStopsAfterMaxRedirects(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, r *http.Request) {
+		http.Redirect(writer, r, r.URL.Path+"x", http.StatusFound)
+	}))
+	defer server.Close()
+
+	hops, err := New(Config{MaxRedirects: 2, AllowPrivateNetworks: true}).Resolve(context.Background(), server.URL+"/")
+
+	if !errors.Is(err, ErrTooManyRedirects) || len(hops) != 3 {
+		t.Errorf("Expected ErrTooManyRedirects after 3 hops, got %v after %d", err, len(hops))
+	}
+}
@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"bufio"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"net"
+	"net/http"
+	"time"
+)
+
+const RequestIdHeader = "X-Request-ID"
+
+const maxRequestIdLength = 128
+
+// Logging wraps the router so that every request, including the ones that do
+// not match a route, gets a request id, a request-scoped logger in its context
+// and exactly one access log line.
+func Logging(router *mux.Router, logger zerolog.Logger) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		requestId := r.Header.Get(RequestIdHeader)
+		if !validRequestId(requestId) {
+			requestId = uuid.NewString()
+		}
+		writer.Header().Set(RequestIdHeader, requestId)
+
+		requestLogger := logger.With().Str("request_id", requestId).Logger()
+		r = r.WithContext(requestLogger.WithContext(r.Context()))
+
+		route, shortCode := "", ""
+		var match mux.RouteMatch
+		if router.Match(r, &match) && match.Route != nil {
+			route, _ = match.Route.GetPathTemplate()
+			shortCode = match.Vars["shortened"]
+		}
+
+		recorder := &responseRecorder{ResponseWriter: writer, status: http.StatusOK}
+		router.ServeHTTP(recorder, r)
+
+		event := requestLogger.Info()
+		if recorder.status >= http.StatusInternalServerError {
+			event = requestLogger.Error()
+		}
+		event.
+			Str("method", r.Method).
+			Str("path", r.URL.Path).
+			Str("route", route).
+			Int("status", recorder.status).
+			Int("bytes", recorder.bytes).
+			Dur("latency", time.Since(start)).
+			Str("short_code", shortCode).
+			Str("remote_addr", r.RemoteAddr).
+			Msg("request")
+	})
+}
+
+func validRequestId(id string) bool {
+	if id == "" || len(id) > maxRequestIdLength {
+		return false
+	}
+	for _, c := range id {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+func (r *responseRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (r *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hijacker, ok := r.ResponseWriter.(http.Hijacker); ok {
+		return hijacker.Hijack()
+	}
+	return nil, nil, errors.New("response writer does not support hijacking")
+}
+
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
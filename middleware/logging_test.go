@@ -0,0 +1,126 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newLoggedRouter(buffer *bytes.Buffer) http.Handler {
+	router := mux.NewRouter()
+	router.HandleFunc("/{shortened}/", func(writer http.ResponseWriter, r *http.Request) {
+		zerolog.Ctx(r.Context()).Info().Msg("handler")
+		http.Redirect(writer, r, "https://example.com", http.StatusFound)
+	}).Methods("GET")
+	return Logging(router, zerolog.New(buffer))
+}
+
+func decodeLogLines(t *testing.T, buffer *bytes.Buffer) []map[string]any {
+	var lines []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buffer.String()), "\n") {
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("Expected JSON log line, got %q", line)
+		}
+		lines = append(lines, entry)
+	}
+	return lines
+}
+
+func TestLoggingGeneratesRequestIdWhenMissing(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	handler := newLoggedRouter(buffer)
+
+	req := httptest.NewRequest(http.MethodGet, "/abc/", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Header().Get(RequestIdHeader) == "" {
+		t.Errorf("Expected %s header to be set", RequestIdHeader)
+	}
+}
+
+func TestLoggingPropagatesIncomingRequestId(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	handler := newLoggedRouter(buffer)
+
+	req := httptest.NewRequest(http.MethodGet, "/abc/", nil)
+	req.Header.Set(RequestIdHeader, "req-123")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Header().Get(RequestIdHeader) != "req-123" {
+		t.Errorf("Expected request id 'req-123', got %s", w.Header().Get(RequestIdHeader))
+	}
+	for _, line := range decodeLogLines(t, buffer) {
+		if line["request_id"] != "req-123" {
+			t.Errorf("Expected every log line to carry request id, got %v", line["request_id"])
+		}
+	}
+}
+
+func TestLoggingReplacesInvalidRequestId(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	handler := newLoggedRouter(buffer)
+
+	req := httptest.NewRequest(http.MethodGet, "/abc/", nil)
+	req.Header.Set(RequestIdHeader, strings.Repeat("x", maxRequestIdLength+1))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if len(w.Header().Get(RequestIdHeader)) > maxRequestIdLength {
+		t.Errorf("Expected oversized request id to be replaced")
+	}
+}
+
+func TestLoggingEmitsAccessLogLine(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	handler := newLoggedRouter(buffer)
+
+	req := httptest.NewRequest(http.MethodGet, "/abc/", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	lines := decodeLogLines(t, buffer)
+	if len(lines) != 2 {
+		t.Fatalf("Expected handler line and access line, got %d lines", len(lines))
+	}
+	access := lines[1]
+	if access["route"] != "/{shortened}/" {
+		t.Errorf("Expected route template '/{shortened}/', got %v", access["route"])
+	}
+	if access["status"] != float64(http.StatusFound) {
+		t.Errorf("Expected status 302, got %v", access["status"])
+	}
+	if access["short_code"] != "abc" {
+		t.Errorf("Expected short code 'abc', got %v", access["short_code"])
+	}
+	if access["bytes"] == float64(0) {
+		t.Errorf("Expected bytes to be recorded")
+	}
+	if _, ok := access["latency"]; !ok {
+		t.Errorf("Expected latency to be recorded")
+	}
+}
+
+func TestLoggingRecordsUnmatchedRequests(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	handler := newLoggedRouter(buffer)
+
+	req := httptest.NewRequest(http.MethodGet, "/does/not/exist", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	lines := decodeLogLines(t, buffer)
+	if len(lines) != 1 {
+		t.Fatalf("Expected one access line, got %d", len(lines))
+	}
+	if lines[0]["status"] != float64(http.StatusNotFound) {
+		t.Errorf("Expected status 404, got %v", lines[0]["status"])
+	}
+}
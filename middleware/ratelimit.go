@@ -0,0 +1,210 @@
+package middleware
+
+import (
+	"fmt"
+	"github.com/gorilla/mux"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"thesilentcoder.com/m/auth"
+	"time"
+)
+
+const idleBucketTtl = 10 * time.Minute
+
+// RateLimiter is a set of token buckets, one per client key, sharing the same
+// refill rate and burst size.
+type RateLimiter struct {
+	mu        sync.Mutex
+	rate      float64
+	burst     int
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type Decision struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration
+	Reset      time.Duration
+}
+
+// NewRateLimiter returns a limiter refilling perMinute tokens every minute up
+// to burst, or nil when perMinute is not positive.
+func NewRateLimiter(perMinute int, burst int) *RateLimiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	if burst <= 0 {
+		burst = perMinute
+	}
+	return &RateLimiter{
+		rate:    float64(perMinute) / 60,
+		burst:   burst,
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+func (l *RateLimiter) Allow(key string) Decision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, exists := l.buckets[key]
+	if !exists {
+		b = &bucket{tokens: float64(l.burst), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(l.burst), b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	decision := Decision{Limit: l.burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		decision.Allowed = true
+	} else {
+		decision.RetryAfter = l.durationFor(1 - b.tokens)
+	}
+	decision.Remaining = int(b.tokens)
+	decision.Reset = l.durationFor(float64(l.burst) - b.tokens)
+	return decision
+}
+
+func (l *RateLimiter) durationFor(tokens float64) time.Duration {
+	return time.Duration(tokens / l.rate * float64(time.Second))
+}
+
+// sweep drops buckets that have been idle long enough to be full again.
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < idleBucketTtl {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > idleBucketTtl {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// RateLimit applies the limiter chosen by limiterFor to each request. Requests
+// for which limiterFor returns nil are not limited.
+func RateLimit(limiterFor func(*http.Request) *RateLimiter, trustedProxies []*net.IPNet, authenticator *auth.Authenticator) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, r *http.Request) {
+			limiter := limiterFor(r)
+			if limiter == nil {
+				next.ServeHTTP(writer, r)
+				return
+			}
+
+			decision := limiter.Allow(ClientKey(r, trustedProxies, authenticator))
+			writer.Header().Set("RateLimit-Limit", strconv.Itoa(decision.Limit))
+			writer.Header().Set("RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+			writer.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(decision.Reset)))
+			if !decision.Allowed {
+				writer.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(decision.RetryAfter)))
+				http.Error(writer, "Too many requests", http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(writer, r)
+		})
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// ClientKey identifies the caller by API key when it presents a valid one and
+// by client IP otherwise, so that made-up keys neither escape the limit nor
+// add buckets.
+func ClientKey(r *http.Request, trustedProxies []*net.IPNet, authenticator *auth.Authenticator) string {
+	if apiKey := auth.KeyFromRequest(r); apiKey != "" && authenticator != nil {
+		if principal, err := authenticator.Authenticate(apiKey); err == nil {
+			return "key:" + principal.KeyId
+		}
+	}
+	return "ip:" + ClientIP(r, trustedProxies)
+}
+
+// ClientIP returns the address of the caller. X-Forwarded-For is only honoured
+// when the direct peer is a trusted proxy, and then the right-most address
+// that is not itself a trusted proxy wins.
+func ClientIP(r *http.Request, trustedProxies []*net.IPNet) string {
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remote = r.RemoteAddr
+	}
+	if !isTrusted(remote, trustedProxies) {
+		return remote
+	}
+
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" || net.ParseIP(hop) == nil {
+			continue
+		}
+		if !isTrusted(hop, trustedProxies) {
+			return hop
+		}
+		remote = hop
+	}
+	return remote
+}
+
+func isTrusted(address string, trustedProxies []*net.IPNet) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, network := range trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTrustedProxies accepts plain IP addresses and CIDR ranges.
+func ParseTrustedProxies(values []string) ([]*net.IPNet, error) {
+	var result []*net.IPNet
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", value)
+			}
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			result = append(result, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", value, err)
+		}
+		result = append(result, network)
+	}
+	return result, nil
+}
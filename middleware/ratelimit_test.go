@@ -0,0 +1,153 @@
+package middleware
+
+import (
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"thesilentcoder.com/m/auth"
+	"time"
+)
+
+func newTestLimiter(perMinute int, burst int, now *time.Time) *RateLimiter {
+	limiter := NewRateLimiter(perMinute, burst)
+	limiter.now = func() time.Time { return *now }
+	return limiter
+}
+
+func TestNewRateLimiterReturnsNilWhenDisabled(t *testing.T) {
+	if limiter := NewRateLimiter(0, 10); limiter != nil {
+		t.Errorf("Expected nil limiter for zero rate, got %v", limiter)
+	}
+}
+
+func TestRateLimiterAllowsBurstThenRejects(t *testing.T) {
+	now := time.Unix(0, 0)
+	limiter := newTestLimiter(60, 2, &now)
+
+	for i := 0; i < 2; i++ {
+		if decision := limiter.Allow("client"); !decision.Allowed {
+			t.Fatalf("Expected request %d to be allowed", i)
+		}
+	}
+	decision := limiter.Allow("client")
+	if decision.Allowed {
+		t.Fatalf("Expected request beyond burst to be rejected")
+	}
+	if decision.RetryAfter != time.Second {
+		t.Errorf("Expected retry after 1s, got %v", decision.RetryAfter)
+	}
+}
+
+func TestRateLimiterRefillsOverTime(t *testing.T) {
+	now := time.Unix(0, 0)
+	limiter := newTestLimiter(60, 1, &now)
+
+	limiter.Allow("client")
+	now = now.Add(time.Second)
+
+	if decision := limiter.Allow("client"); !decision.Allowed {
+		t.Errorf("Expected token to be refilled after one second")
+	}
+}
+
+func TestRateLimiterKeepsClientsSeparate(t *testing.T) {
+	now := time.Unix(0, 0)
+	limiter := newTestLimiter(60, 1, &now)
+
+	limiter.Allow("first")
+	if decision := limiter.Allow("second"); !decision.Allowed {
+		t.Errorf("Expected a different client to have its own budget")
+	}
+}
+
+func TestRateLimitMiddlewareReturnsTooManyRequests(t *testing.T) {
+	now := time.Unix(0, 0)
+	limiter := newTestLimiter(60, 1, &now)
+
+	router := mux.NewRouter()
+	router.Use(RateLimit(func(*http.Request) *RateLimiter { return limiter }, nil, nil))
+	router.HandleFunc("/{shortened}/", func(writer http.ResponseWriter, r *http.Request) {})
+
+	first := httptest.NewRecorder()
+	router.ServeHTTP(first, httptest.NewRequest(http.MethodGet, "/abc/", nil))
+	if first.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", first.Code)
+	}
+	if first.Header().Get("RateLimit-Limit") != "1" {
+		t.Errorf("Expected RateLimit-Limit 1, got %s", first.Header().Get("RateLimit-Limit"))
+	}
+	if first.Header().Get("RateLimit-Remaining") != "0" {
+		t.Errorf("Expected RateLimit-Remaining 0, got %s", first.Header().Get("RateLimit-Remaining"))
+	}
+
+	second := httptest.NewRecorder()
+	router.ServeHTTP(second, httptest.NewRequest(http.MethodGet, "/abc/", nil))
+	if second.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status 429, got %d", second.Code)
+	}
+	if second.Header().Get("Retry-After") != "1" {
+		t.Errorf("Expected Retry-After 1, got %s", second.Header().Get("Retry-After"))
+	}
+}
+
+func TestClientIPIgnoresForwardedForFromUntrustedPeer(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "203.0.113.7:1234"
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+
+	if ip := ClientIP(req, nil); ip != "203.0.113.7" {
+		t.Errorf("Expected peer address, got %s", ip)
+	}
+}
+
+func TestClientIPUsesForwardedForFromTrustedProxy(t *testing.T) {
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.1.2.3:1234"
+	req.Header.Set("X-Forwarded-For", "1.1.1.1, 198.51.100.1, 192.168.1.1")
+
+	if ip := ClientIP(req, trusted); ip != "198.51.100.1" {
+		t.Errorf("Expected right-most untrusted address, got %s", ip)
+	}
+}
+
+func TestClientKeyPrefersApiKey(t *testing.T) {
+	authenticator, err := auth.New([]auth.Key{{Id: "ci", Hash: auth.HashKey("secret")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(auth.ApiKeyHeader, "secret")
+
+	key := ClientKey(req, nil, authenticator)
+	if key != "key:ci" {
+		t.Errorf("Expected API key based client key, got %s", key)
+	}
+}
+
+func TestClientKeyIgnoresInvalidApiKeys(t *testing.T) {
+	authenticator, err := auth.New([]auth.Key{{Id: "ci", Hash: auth.HashKey("secret")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "203.0.113.7:1234"
+	req.Header.Set(auth.ApiKeyHeader, "made-up")
+
+	if key := ClientKey(req, nil, authenticator); key != "ip:203.0.113.7" {
+		t.Errorf("Expected an invalid key to fall back to the client IP, got %s", key)
+	}
+	if key := ClientKey(req, nil, nil); key != "ip:203.0.113.7" {
+		t.Errorf("Expected keys to be ignored without authentication, got %s", key)
+	}
+}
+
+func TestParseTrustedProxiesRejectsGarbage(t *testing.T) {
+	if _, err := ParseTrustedProxies([]string{"not-an-ip"}); err == nil {
+		t.Errorf("Expected error for invalid proxy, got nil")
+	}
+}
@@ -1,9 +1,18 @@
 package repository
 
+import "context"
+
 type Repository[T any] interface {
-	GetById(id int) (*T, error)
-	GetByValue(val string) (*T, error)
-	Insert(item *T) (*T, error)
-	Update(item *T) error
-	Next() (int, error)
+	GetById(ctx context.Context, id int) (*T, error)
+	GetByValue(ctx context.Context, val string) (*T, error)
+	Insert(ctx context.Context, item *T) (*T, error)
+	// Update records a visit of item and returns its new visit count.
+	Update(ctx context.Context, item *T) (int, error)
+	// Modify applies modify to the item with the given id under the
+	// repository lock and returns the modified item. Only the fields modify
+	// touches change, so concurrent modifications of other fields are kept.
+	Modify(ctx context.Context, id int, modify func(item *T)) (*T, error)
+	Delete(ctx context.Context, id int) error
+	Next(ctx context.Context) (int, error)
+	List(ctx context.Context) ([]*T, error)
 }
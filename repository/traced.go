@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"context"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "thesilentcoder.com/m/repository"
+
+// Traced decorates a Repository with one span per call.
+type Traced[T any] struct {
+	inner Repository[T]
+	name  string
+}
+
+func NewTraced[T any](inner Repository[T], name string) *Traced[T] {
+	return &Traced[T]{inner: inner, name: name}
+}
+
+func (t *Traced[T]) GetById(ctx context.Context, id int) (*T, error) {
+	ctx, span := t.start(ctx, "GetById", attribute.Int("repository.id", id))
+	defer span.End()
+	item, err := t.inner.GetById(ctx, id)
+	return item, record(span, err)
+}
+
+func (t *Traced[T]) GetByValue(ctx context.Context, val string) (*T, error) {
+	ctx, span := t.start(ctx, "GetByValue", attribute.String("repository.value", val))
+	defer span.End()
+	item, err := t.inner.GetByValue(ctx, val)
+	return item, record(span, err)
+}
+
+func (t *Traced[T]) Insert(ctx context.Context, item *T) (*T, error) {
+	ctx, span := t.start(ctx, "Insert")
+	defer span.End()
+	inserted, err := t.inner.Insert(ctx, item)
+	return inserted, record(span, err)
+}
+
+func (t *Traced[T]) Update(ctx context.Context, item *T) (int, error) {
+	ctx, span := t.start(ctx, "Update")
+	defer span.End()
+	visits, err := t.inner.Update(ctx, item)
+	return visits, record(span, err)
+}
+
+func (t *Traced[T]) Modify(ctx context.Context, id int, modify func(item *T)) (*T, error) {
+	ctx, span := t.start(ctx, "Modify", attribute.Int("repository.id", id))
+	defer span.End()
+	modified, err := t.inner.Modify(ctx, id, modify)
+	return modified, record(span, err)
+}
+
+func (t *Traced[T]) Delete(ctx context.Context, id int) error {
+	ctx, span := t.start(ctx, "Delete", attribute.Int("repository.id", id))
+	defer span.End()
+	return record(span, t.inner.Delete(ctx, id))
+}
+
+func (t *Traced[T]) Next(ctx context.Context) (int, error) {
+	ctx, span := t.start(ctx, "Next")
+	defer span.End()
+	next, err := t.inner.Next(ctx)
+	return next, record(span, err)
+}
+
+func (t *Traced[T]) List(ctx context.Context) ([]*T, error) {
+	ctx, span := t.start(ctx, "List")
+	defer span.End()
+	items, err := t.inner.List(ctx)
+	span.SetAttributes(attribute.Int("repository.count", len(items)))
+	return items, record(span, err)
+}
+
+func (t *Traced[T]) start(ctx context.Context, operation string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	attributes = append(attributes, attribute.String("repository.name", t.name))
+	return otel.Tracer(tracerName).Start(ctx, t.name+"."+operation, trace.WithAttributes(attributes...))
+}
+
+func record(span trace.Span, err error) error {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
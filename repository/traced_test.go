@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"testing"
+)
+
+type item struct{}
+
+type failingRepository struct{}
+
+func (failingRepository) GetById(context.Context, int) (*item, error) { return &item{}, nil }
+func (failingRepository) GetByValue(context.Context, string) (*item, error) {
+	return nil, errors.New("not found")
+}
+func (failingRepository) Insert(_ context.Context, i *item) (*item, error) { return i, nil }
+func (failingRepository) Update(context.Context, *item) (int, error)       { return 1, nil }
+func (failingRepository) Modify(_ context.Context, _ int, modify func(*item)) (*item, error) {
+	i := &item{}
+	modify(i)
+	return i, nil
+}
+func (failingRepository) Delete(context.Context, int) error     { return nil }
+func (failingRepository) Next(context.Context) (int, error)     { return 0, nil }
+func (failingRepository) List(context.Context) ([]*item, error) { return nil, nil }
+
+func TestTracedRecordsSpanPerCall(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(previous)
+
+	traced := NewTraced[item](failingRepository{}, "items")
+	_, _ = traced.GetById(context.Background(), 1)
+	_, _ = traced.GetByValue(context.Background(), "abc")
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(spans))
+	}
+	if spans[0].Name() != "items.GetById" {
+		t.Errorf("Expected span 'items.GetById', got %s", spans[0].Name())
+	}
+	if spans[1].Status().Code != codes.Error {
+		t.Errorf("Expected failed call to mark span as error, got %v", spans[1].Status().Code)
+	}
+}
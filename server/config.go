@@ -5,6 +5,7 @@ import (
 	"github.com/knadh/koanf/providers/file"
 	"github.com/knadh/koanf/v2"
 	"github.com/rs/zerolog"
+	"time"
 )
 
 type Config struct {
@@ -13,6 +14,51 @@ type Config struct {
 	ApiVersion  int    `koanf:"api_version"`
 	RedirectUrl string `koanf:"redirect_url"`
 	LogLevel    zerolog.Level
+
+	TracingExporter    string   `koanf:"tracing_exporter"`
+	TracingEndpoint    string   `koanf:"tracing_endpoint"`
+	TracingSampleRatio *float64 `koanf:"tracing_sample_ratio"`
+
+	RateLimitApiPerMinute      int      `koanf:"rate_limit_api_per_minute"`
+	RateLimitApiBurst          int      `koanf:"rate_limit_api_burst"`
+	RateLimitRedirectPerMinute int      `koanf:"rate_limit_redirect_per_minute"`
+	RateLimitRedirectBurst     int      `koanf:"rate_limit_redirect_burst"`
+	TrustedProxies             []string `koanf:"trusted_proxies"`
+
+	ApiKeysFile     string `koanf:"api_keys_file"`
+	ApiAuthDisabled bool   `koanf:"api_auth_disabled"`
+
+	LinkCookieSecret string        `koanf:"link_cookie_secret"`
+	LinkCookieTtl    time.Duration `koanf:"link_cookie_ttl"`
+
+	CountryHeader string `koanf:"country_header"`
+	Timezone      string `koanf:"timezone"`
+
+	AppleAppSiteAssociationFile string `koanf:"apple_app_site_association_file"`
+	AssetLinksFile              string `koanf:"asset_links_file"`
+
+	DomainBlocklistFile string   `koanf:"domain_blocklist_file"`
+	DomainAllowlistFile string   `koanf:"domain_allowlist_file"`
+	AllowedSchemes      []string `koanf:"allowed_schemes"`
+
+	LivenessInterval    time.Duration `koanf:"liveness_interval"`
+	LivenessConcurrency int           `koanf:"liveness_concurrency"`
+	LivenessHostDelay   time.Duration `koanf:"liveness_host_delay"`
+	FailoverThreshold   int           `koanf:"failover_threshold"`
+
+	FetchMetadata             bool          `koanf:"fetch_metadata"`
+	FetchTimeout              time.Duration `koanf:"fetch_timeout"`
+	FetchMaxBytes             int64         `koanf:"fetch_max_bytes"`
+	FetchMaxRedirects         int           `koanf:"fetch_max_redirects"`
+	FetchAllowPrivateNetworks bool          `koanf:"fetch_allow_private_networks"`
+
+	ArchiveDir      string        `koanf:"archive_dir"`
+	ArchiveInterval time.Duration `koanf:"archive_interval"`
+
+	WebhookStoreFile       string `koanf:"webhook_store_file"`
+	WebhookVisitThresholds []int  `koanf:"webhook_visit_thresholds"`
+
+	EventStreamBuffer int `koanf:"event_stream_buffer"`
 }
 
 func LoadConfig(filePath string) (*Config, error) {
@@ -9,29 +9,184 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
+	"thesilentcoder.com/m/archive"
+	"thesilentcoder.com/m/auth"
+	"thesilentcoder.com/m/domainpolicy"
+	"thesilentcoder.com/m/events"
+	"thesilentcoder.com/m/fetch"
 	"thesilentcoder.com/m/health"
+	"thesilentcoder.com/m/middleware"
+	"thesilentcoder.com/m/repository"
+	"thesilentcoder.com/m/stream"
+	"thesilentcoder.com/m/tracing"
 	"thesilentcoder.com/m/url"
+	"thesilentcoder.com/m/webhook"
+	"thesilentcoder.com/m/wellknown"
+	"time"
 )
 
 func Start(ctx context.Context, config Config) error {
-	repository := url.NewRepository()
-	urlService := url.New(repository, config.Port, config.RedirectUrl, config.ApiPrefix, config.ApiVersion)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	shutdownTracing, err := tracing.Setup(ctx, tracing.Config{
+		ServiceName: serviceName,
+		Exporter:    config.TracingExporter,
+		Endpoint:    config.TracingEndpoint,
+		SampleRatio: config.TracingSampleRatio,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set up tracing: %w", err)
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			log.Error().Err(err).Msg("Failed to flush traces")
+		}
+	}()
+
+	trustedProxies, err := middleware.ParseTrustedProxies(config.TrustedProxies)
+	if err != nil {
+		return err
+	}
+
+	var authenticator *auth.Authenticator
+	if config.ApiKeysFile != "" {
+		authenticator, err = auth.LoadKeys(config.ApiKeysFile)
+		if err != nil {
+			return fmt.Errorf("failed to load API keys: %w", err)
+		}
+	} else if config.ApiAuthDisabled {
+		log.Warn().Msg("API authentication disabled, the management API is open")
+	} else {
+		return errors.New("api_keys_file is required unless api_auth_disabled is set")
+	}
+
+	location := time.UTC
+	if config.Timezone != "" {
+		location, err = time.LoadLocation(config.Timezone)
+		if err != nil {
+			return fmt.Errorf("invalid timezone: %w", err)
+		}
+	}
+
+	if config.LinkCookieSecret == "" {
+		log.Warn().Msg("No link cookie secret configured, unlocked password links will ask again after a restart")
+	}
+
+	domains, err := domainpolicy.Load(config.DomainBlocklistFile, config.DomainAllowlistFile)
+	if err != nil {
+		return fmt.Errorf("failed to load domain rules: %w", err)
+	}
+	if domains != nil {
+		if err := domains.Watch(ctx, log.Logger); err != nil {
+			return fmt.Errorf("failed to watch domain rules: %w", err)
+		}
+	}
+
+	fetchClient := fetch.New(fetch.Config{
+		Timeout:              config.FetchTimeout,
+		MaxBytes:             config.FetchMaxBytes,
+		MaxRedirects:         config.FetchMaxRedirects,
+		AllowPrivateNetworks: config.FetchAllowPrivateNetworks,
+	})
+	var metadataClient *fetch.Client
+	if config.FetchMetadata {
+		metadataClient = fetchClient
+	}
+
+	broker := stream.NewBroker(config.EventStreamBuffer)
+	publishers := events.Publishers{broker}
+	var webhookService *webhook.Service
+	if config.WebhookStoreFile != "" {
+		dispatcher, err := webhook.NewDispatcher(config.WebhookStoreFile, fetchClient)
+		if err != nil {
+			return fmt.Errorf("failed to load webhooks: %w", err)
+		}
+		go dispatcher.Run(ctx)
+		publishers = append(publishers, dispatcher)
+		webhookService = webhook.New(dispatcher, config.ApiPrefix, config.ApiVersion, authenticator)
+	}
+
+	urlRepository := repository.NewTraced[url.Url](url.NewRepository(), "url")
+	var archiver *url.Archiver
+	if config.ArchiveDir != "" {
+		store, err := archive.NewStore(config.ArchiveDir)
+		if err != nil {
+			return fmt.Errorf("failed to open archive: %w", err)
+		}
+		archiver = url.NewArchiver(urlRepository, store, fetchClient, config.ArchiveInterval)
+		go archiver.Run(ctx)
+	}
+	urlService := url.New(urlRepository, config.Port, config.RedirectUrl, config.ApiPrefix, config.ApiVersion,
+		url.WithAuthenticator(authenticator),
+		url.WithTrustedProxies(trustedProxies),
+		url.WithPasswordCookies([]byte(config.LinkCookieSecret), config.LinkCookieTtl),
+		url.WithCountryHeader(config.CountryHeader),
+		url.WithLocation(location),
+		url.WithDomainPolicy(domains),
+		url.WithAllowedSchemes(config.AllowedSchemes),
+		url.WithFailoverThreshold(config.FailoverThreshold),
+		url.WithMetadataFetching(metadataClient),
+		url.WithRedirectResolution(fetchClient),
+		url.WithArchiver(archiver),
+		url.WithPublisher(publishers),
+		url.WithVisitThresholds(config.WebhookVisitThresholds))
+	go urlService.WatchExpiry(ctx)
+	livenessChecker := url.NewLivenessChecker(urlRepository, fetchClient, url.LivenessConfig{
+		Interval:    config.LivenessInterval,
+		Concurrency: config.LivenessConcurrency,
+		HostDelay:   config.LivenessHostDelay,
+	})
+	if livenessChecker != nil {
+		go livenessChecker.Run(ctx)
+	}
 	healthService := health.New()
-	services := []Service{urlService, healthService}
+	wellKnownService, err := wellknown.New(config.AppleAppSiteAssociationFile, config.AssetLinksFile)
+	if err != nil {
+		return fmt.Errorf("failed to load app association files: %w", err)
+	}
+	// The well-known files and the other APIs go first, the redirect routes
+	// would match them too.
+	services := []Service{wellKnownService, stream.New(broker, config.ApiPrefix, config.ApiVersion, authenticator)}
+	if webhookService != nil {
+		services = append(services, webhookService)
+	}
+	services = append(services, urlService, healthService)
+
+	apiLimiter := middleware.NewRateLimiter(config.RateLimitApiPerMinute, config.RateLimitApiBurst)
+	redirectLimiter := middleware.NewRateLimiter(config.RateLimitRedirectPerMinute, config.RateLimitRedirectBurst)
+	apiRoutes := fmt.Sprintf("/%s/v%d/", config.ApiPrefix, config.ApiVersion)
 
 	httpHandler := mux.NewRouter()
+	httpHandler.Use(tracing.Middleware)
+	httpHandler.Use(middleware.RateLimit(func(r *http.Request) *middleware.RateLimiter {
+		route, err := mux.CurrentRoute(r).GetPathTemplate()
+		switch {
+		case err != nil:
+			return nil
+		case strings.HasPrefix(route, apiRoutes):
+			return apiLimiter
+		case strings.HasPrefix(route, "/{shortened}"):
+			return redirectLimiter
+		default:
+			return nil
+		}
+	}, trustedProxies, authenticator))
 	for _, service := range services {
 		service.RegisterHandlers(httpHandler)
 	}
 
-	httpServer := &http.Server{Addr: config.Port, Handler: httpHandler}
+	httpServer := &http.Server{Addr: config.Port, Handler: middleware.Logging(httpHandler, log.Logger)}
+	// Open event streams would otherwise keep Shutdown waiting.
+	httpServer.RegisterOnShutdown(broker.Close)
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
 	listenChan := make(chan error)
 	go func() {
-		fmt.Printf("Starting HTTP server on %s\n", config.Port)
+		log.Info().Str("addr", config.Port).Msg("Starting HTTP server")
 		err := httpServer.ListenAndServe()
 		if err != nil && !errors.Is(err, http.ErrServerClosed) {
 			// couldn't Start server
@@ -60,6 +215,8 @@ func Start(ctx context.Context, config Config) error {
 	return nil
 }
 
+const serviceName = "url-shortener"
+
 type Service interface {
 	RegisterHandlers(mux *mux.Router)
 }
@@ -10,7 +10,7 @@ func TestStartsServerSuccessfully(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	config := Config{Port: ":0"}
+	config := Config{Port: ":0", ApiAuthDisabled: true}
 
 	go func() {
 		time.Sleep(100 * time.Millisecond)
@@ -25,7 +25,7 @@ func TestStartsServerSuccessfully(t *testing.T) {
 
 func TestReturnsErrorWhenServerFailsToStart(t *testing.T) {
 	ctx := context.Background()
-	config := Config{Port: "invalid-port"}
+	config := Config{Port: "invalid-port", ApiAuthDisabled: true}
 
 	err := Start(ctx, config)
 	if err == nil {
@@ -35,7 +35,7 @@ func TestReturnsErrorWhenServerFailsToStart(t *testing.T) {
 
 func TestShutsDownGracefullyOnContextCancellation(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
-	config := Config{Port: ":0"}
+	config := Config{Port: ":0", ApiAuthDisabled: true}
 
 	go func() {
 		time.Sleep(100 * time.Millisecond)
@@ -47,3 +47,10 @@ func TestShutsDownGracefullyOnContextCancellation(t *testing.T) {
 		t.Errorf("Expected graceful shutdown, got error: %v", err)
 	}
 }
+
+func TestRefusesToStartWithoutApiKeys(t *testing.T) {
+	err := Start(context.Background(), Config{Port: ":0"})
+	if err == nil {
+		t.Fatalf("Expected error without API keys, got nil")
+	}
+}
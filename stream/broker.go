@@ -0,0 +1,148 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"thesilentcoder.com/m/events"
+	"time"
+)
+
+const (
+	defaultBufferSize = 1000
+	// subscriberBuffer is how many events a subscriber may fall behind
+	// before it is dropped. Its client reconnects and resumes from the
+	// buffer.
+	subscriberBuffer = 64
+)
+
+// Entry is an event with its position in the stream.
+type Entry struct {
+	Id       string
+	Event    events.Event
+	sequence uint64
+}
+
+// Broker keeps the latest events in a ring buffer and fans them out to the
+// open streams.
+type Broker struct {
+	mu sync.Mutex
+	// epoch tells the ids of this process apart from those handed out
+	// before a restart.
+	epoch       string
+	sequence    uint64
+	buffer      []Entry
+	start       int
+	subscribers map[*subscriber]struct{}
+	closed      bool
+}
+
+type subscriber struct {
+	events chan Entry
+	accept func(events.Event) bool
+}
+
+// NewBroker keeps the latest size events for resuming streams, 1000 when size
+// is not positive.
+func NewBroker(size int) *Broker {
+	if size <= 0 {
+		size = defaultBufferSize
+	}
+	return &Broker{
+		epoch:       strconv.FormatInt(time.Now().UnixNano(), 36),
+		buffer:      make([]Entry, 0, size),
+		subscribers: make(map[*subscriber]struct{}),
+	}
+}
+
+func (b *Broker) Publish(_ context.Context, event events.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.sequence++
+	entry := Entry{Id: fmt.Sprintf("%s-%d", b.epoch, b.sequence), Event: event, sequence: b.sequence}
+	if len(b.buffer) < cap(b.buffer) {
+		b.buffer = append(b.buffer, entry)
+	} else {
+		b.buffer[b.start] = entry
+		b.start = (b.start + 1) % len(b.buffer)
+	}
+	for s := range b.subscribers {
+		if !s.accept(event) {
+			continue
+		}
+		select {
+		case s.events <- entry:
+		default:
+			b.drop(s)
+		}
+	}
+}
+
+// Subscribe returns the buffered events after lastId that accept lets
+// through, and a channel with the ones that follow. The channel is closed
+// when the subscriber falls behind, the broker closes or cancel is called.
+// An unknown lastId replays the whole buffer, an empty one nothing.
+func (b *Broker) Subscribe(lastId string, accept func(events.Event) bool) (backlog []Entry, live <-chan Entry, cancel func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := &subscriber{events: make(chan Entry, subscriberBuffer), accept: accept}
+	if b.closed {
+		close(s.events)
+		return nil, s.events, func() {}
+	}
+	if lastId != "" {
+		after, known := b.position(lastId)
+		for i := range len(b.buffer) {
+			entry := b.buffer[(b.start+i)%len(b.buffer)]
+			if known && entry.sequence <= after {
+				continue
+			}
+			if accept(entry.Event) {
+				backlog = append(backlog, entry)
+			}
+		}
+	}
+	b.subscribers[s] = struct{}{}
+	return backlog, s.events, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.drop(s)
+	}
+}
+
+// position returns the sequence number of an id handed out by this broker.
+func (b *Broker) position(id string) (uint64, bool) {
+	epoch, sequence, found := strings.Cut(id, "-")
+	if !found || epoch != b.epoch {
+		return 0, false
+	}
+	position, err := strconv.ParseUint(sequence, 10, 64)
+	if err != nil || position > b.sequence {
+		return 0, false
+	}
+	return position, true
+}
+
+// drop must be called with mu held.
+func (b *Broker) drop(s *subscriber) {
+	if _, subscribed := b.subscribers[s]; subscribed {
+		delete(b.subscribers, s)
+		close(s.events)
+	}
+}
+
+// Close ends every open stream and refuses new ones, so that the server can
+// shut down.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for s := range b.subscribers {
+		b.drop(s)
+	}
+}
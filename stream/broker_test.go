@@ -0,0 +1,95 @@
+package stream
+
+import (
+	"context"
+	"testing"
+	"thesilentcoder.com/m/events"
+)
+
+func acceptAll(events.Event) bool { return true }
+
+func publishLinks(broker *Broker, ids ...int) {
+	for _, id := range ids {
+		broker.Publish(context.Background(), events.New(events.LinkVisited, events.Link{Id: id}))
+	}
+}
+
+func TestSubscribeReceivesLiveEvents(t *testing.T) {
+	broker := NewBroker(10)
+	backlog, live, cancel := broker.Subscribe("", acceptAll)
+	defer cancel()
+	if len(backlog) != 0 {
+		t.Errorf("Expected no backlog without Last-Event-ID, got %d", len(backlog))
+	}
+
+	publishLinks(broker, 1)
+
+	entry := <-live
+	if entry.Event.Link.Id != 1 || entry.Id == "" {
+		t.Errorf("Expected the event for link 1 with an id, got %+v", entry)
+	}
+}
+
+func TestSubscribeResumesAfterLastEventId(t *testing.T) {
+	broker := NewBroker(10)
+	_, live, cancel := broker.Subscribe("", acceptAll)
+	publishLinks(broker, 1, 2, 3)
+	first := <-live
+	cancel()
+
+	backlog, _, cancel := broker.Subscribe(first.Id, acceptAll)
+	defer cancel()
+	if len(backlog) != 2 || backlog[0].Event.Link.Id != 2 || backlog[1].Event.Link.Id != 3 {
+		t.Errorf("Expected the events after the first one, got %+v", backlog)
+	}
+}
+
+func TestBufferKeepsTheLatestEvents(t *testing.T) {
+	broker := NewBroker(3)
+	publishLinks(broker, 1, 2, 3, 4, 5)
+
+	backlog, _, cancel := broker.Subscribe("unknown", acceptAll)
+	defer cancel()
+	if len(backlog) != 3 {
+		t.Fatalf("Expected the 3 buffered events, got %d", len(backlog))
+	}
+	for i, id := range []int{3, 4, 5} {
+		if backlog[i].Event.Link.Id != id {
+			t.Errorf("Expected link %d at %d, got %d", id, i, backlog[i].Event.Link.Id)
+		}
+	}
+}
+
+func TestSlowSubscribersAreDropped(t *testing.T) {
+	broker := NewBroker(10)
+	_, live, cancel := broker.Subscribe("", acceptAll)
+	defer cancel()
+
+	for i := range subscriberBuffer + 1 {
+		publishLinks(broker, i)
+	}
+
+	received := 0
+	for range live {
+		received++
+	}
+	if received != subscriberBuffer {
+		t.Errorf("Expected %d events before the channel closed, got %d", subscriberBuffer, received)
+	}
+}
+
+func TestCloseEndsStreams(t *testing.T) {
+	broker := NewBroker(10)
+	_, live, cancel := broker.Subscribe("", acceptAll)
+	defer cancel()
+
+	broker.Close()
+
+	if _, open := <-live; open {
+		t.Errorf("Expected the stream to be closed")
+	}
+	_, live, _ = broker.Subscribe("", acceptAll)
+	if _, open := <-live; open {
+		t.Errorf("Expected new streams to be closed right away")
+	}
+}
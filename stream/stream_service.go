@@ -0,0 +1,136 @@
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"slices"
+	"strconv"
+	"thesilentcoder.com/m/auth"
+	"thesilentcoder.com/m/events"
+	"thesilentcoder.com/m/tracing"
+	"time"
+)
+
+const (
+	heartbeatInterval = 15 * time.Second
+	retryMilliseconds = 3000
+)
+
+// Service streams link events as Server-Sent Events.
+type Service struct {
+	broker        *Broker
+	apiPrefix     string
+	apiVersion    int
+	authenticator *auth.Authenticator
+}
+
+func New(broker *Broker, apiPrefix string, apiVersion int, authenticator *auth.Authenticator) *Service {
+	return &Service{
+		broker:        broker,
+		apiPrefix:     apiPrefix,
+		apiVersion:    apiVersion,
+		authenticator: authenticator,
+	}
+}
+
+func (s Service) RegisterHandlers(router *mux.Router) {
+	formattedUrl := fmt.Sprintf("/%s/v%d/", s.apiPrefix, s.apiVersion)
+	router.HandleFunc(formattedUrl+"events", tracing.Handler("stream.handleEvents", s.authenticator.Require(auth.ScopeEventsRead, s.handleEvents))).Methods("GET")
+}
+
+// filter selects the events of a stream. Zero fields match everything.
+type filter struct {
+	linkId *int
+	tag    string
+	owner  string
+}
+
+func (f filter) accept(event events.Event) bool {
+	return (f.linkId == nil || event.Link.Id == *f.linkId) &&
+		(f.tag == "" || slices.Contains(event.Link.Tags, f.tag)) &&
+		(f.owner == "" || event.Link.Owner == f.owner)
+}
+
+// parseFilter reads the link, tag and owner query parameters. Authenticated
+// callers only see the events of their own links.
+func parseFilter(r *http.Request) (filter, int, error) {
+	query := r.URL.Query()
+	f := filter{tag: query.Get("tag"), owner: query.Get("owner")}
+	if link := query.Get("link"); link != "" {
+		id, err := strconv.Atoi(link)
+		if err != nil {
+			return filter{}, http.StatusBadRequest, fmt.Errorf("invalid link id")
+		}
+		f.linkId = &id
+	}
+	if auth.PrincipalFrom(r.Context()) != nil {
+		owner := auth.OwnerFrom(r.Context())
+		if f.owner != "" && f.owner != owner {
+			return filter{}, http.StatusForbidden, fmt.Errorf("events of other owners are not visible")
+		}
+		f.owner = owner
+	}
+	return f, http.StatusOK, nil
+}
+
+func (s Service) handleEvents(writer http.ResponseWriter, r *http.Request) {
+	f, status, err := parseFilter(r)
+	if err != nil {
+		http.Error(writer, err.Error(), status)
+		return
+	}
+	backlog, live, cancel := s.broker.Subscribe(r.Header.Get("Last-Event-ID"), f.accept)
+	defer cancel()
+
+	controller := http.NewResponseController(writer)
+	writer.Header().Set("Content-Type", "text/event-stream")
+	writer.Header().Set("Cache-Control", "no-cache")
+	// Keeps reverse proxies from buffering the stream.
+	writer.Header().Set("X-Accel-Buffering", "no")
+	writer.WriteHeader(http.StatusOK)
+	if _, err := fmt.Fprintf(writer, "retry: %d\n\n", retryMilliseconds); err != nil {
+		return
+	}
+	for _, entry := range backlog {
+		if err := writeEntry(writer, entry); err != nil {
+			return
+		}
+	}
+	if err := controller.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case entry, open := <-live:
+			if !open {
+				return
+			}
+			if err := writeEntry(writer, entry); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(writer, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		if err := controller.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func writeEntry(writer http.ResponseWriter, entry Entry) error {
+	data, err := json.Marshal(entry.Event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(writer, "id: %s\nevent: %s\ndata: %s\n\n", entry.Id, entry.Event.Type, data)
+	return err
+}
@@ -0,0 +1,155 @@
+package stream
+
+import (
+	"bufio"
+	"context"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"thesilentcoder.com/m/auth"
+	"thesilentcoder.com/m/events"
+	"time"
+)
+
+func newTestServer(t *testing.T, authenticator *auth.Authenticator) (*httptest.Server, *Broker) {
+	broker := NewBroker(10)
+	router := mux.NewRouter()
+	New(broker, "api", 1, authenticator).RegisterHandlers(router)
+	server := httptest.NewServer(router)
+	t.Cleanup(func() {
+		broker.Close()
+		server.Close()
+	})
+	return server, broker
+}
+
+// readEvents reads count events from an SSE stream and returns their lines.
+func readEvents(t *testing.T, response *http.Response, count int) []string {
+	var lines []string
+	scanner := bufio.NewScanner(response.Body)
+	for count > 0 && scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "id: ") || strings.HasPrefix(line, "event: ") || strings.HasPrefix(line, "data: ") {
+			lines = append(lines, line)
+		}
+		if strings.HasPrefix(line, "data: ") {
+			count--
+		}
+	}
+	if count > 0 {
+		t.Fatalf("Expected %d more events, stream ended: %v", count, scanner.Err())
+	}
+	return lines
+}
+
+func openStream(t *testing.T, url string, lastEventId string) *http.Response {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	r, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if lastEventId != "" {
+		r.Header.Set("Last-Event-ID", lastEventId)
+	}
+	response, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { response.Body.Close() })
+	return response
+}
+
+func TestStreamsFilteredEvents(t *testing.T) {
+	server, broker := newTestServer(t, nil)
+	response := openStream(t, server.URL+"/api/v1/events?tag=launch", "")
+	if response.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %s", response.Header.Get("Content-Type"))
+	}
+
+	broker.Publish(context.Background(), events.New(events.LinkVisited, events.Link{Id: 1}))
+	broker.Publish(context.Background(), events.New(events.LinkVisited, events.Link{Id: 2, Tags: []string{"launch"}}))
+
+	lines := readEvents(t, response, 1)
+	if len(lines) != 3 || lines[1] != "event: link.visited" || !strings.Contains(lines[2], `"id":2`) {
+		t.Errorf("Expected only the tagged link's event, got %v", lines)
+	}
+}
+
+func TestStreamResumesFromLastEventId(t *testing.T) {
+	server, broker := newTestServer(t, nil)
+	for id := range 3 {
+		broker.Publish(context.Background(), events.New(events.LinkCreated, events.Link{Id: id}))
+	}
+	backlog, _, cancel := broker.Subscribe("unknown", acceptAll)
+	cancel()
+
+	response := openStream(t, server.URL+"/api/v1/events", backlog[0].Id)
+	lines := readEvents(t, response, 2)
+	if lines[0] != "id: "+backlog[1].Id || lines[3] != "id: "+backlog[2].Id {
+		t.Errorf("Expected the events after the last one seen, got %v", lines)
+	}
+}
+
+func TestStreamIsScopedToOwner(t *testing.T) {
+	authenticator, err := auth.New([]auth.Key{
+		{Id: "a", Hash: auth.HashKey("key-a"), Owner: "acme", Scopes: []string{auth.ScopeEventsRead}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, broker := newTestServer(t, authenticator)
+
+	r, _ := http.NewRequest(http.MethodGet, server.URL+"/api/v1/events?owner=other", nil)
+	r.Header.Set(auth.ApiKeyHeader, "key-a")
+	response, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected status 403 for another owner, got %d", response.StatusCode)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	r, _ = http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/api/v1/events", nil)
+	r.Header.Set(auth.ApiKeyHeader, "key-a")
+	response, err = http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	broker.Publish(context.Background(), events.New(events.LinkVisited, events.Link{Id: 1, Owner: "other"}))
+	broker.Publish(context.Background(), events.New(events.LinkVisited, events.Link{Id: 2, Owner: "acme"}))
+
+	lines := readEvents(t, response, 1)
+	if !strings.Contains(lines[2], `"id":2`) {
+		t.Errorf("Expected only the caller's events, got %v", lines)
+	}
+}
+
+func TestStreamEndsWhenBrokerCloses(t *testing.T) {
+	server, broker := newTestServer(t, nil)
+	response := openStream(t, server.URL+"/api/v1/events", "")
+
+	broker.Close()
+
+	scanner := bufio.NewScanner(response.Body)
+	for scanner.Scan() {
+	}
+	if err := scanner.Err(); err != nil {
+		t.Errorf("Expected the stream to end cleanly, got %v", err)
+	}
+}
+
+func TestStreamRejectsInvalidLinkId(t *testing.T) {
+	broker := NewBroker(10)
+	router := mux.NewRouter()
+	New(broker, "api", 1, nil).RegisterHandlers(router)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/events?link=abc", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+}
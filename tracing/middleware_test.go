@@ -0,0 +1,56 @@
+package tracing
+
+import (
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newRecordingProvider(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+func TestMiddlewareContinuesIncomingTrace(t *testing.T) {
+	recorder := newRecordingProvider(t)
+
+	router := mux.NewRouter()
+	router.Use(Middleware)
+	router.HandleFunc("/{shortened}/", Handler("redirect", func(writer http.ResponseWriter, r *http.Request) {
+		writer.WriteHeader(http.StatusFound)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/abc/", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("Expected server and handler spans, got %d", len(spans))
+	}
+	handler, server := spans[0], spans[1]
+	if server.Name() != "GET /{shortened}/" {
+		t.Errorf("Expected server span to be named after route, got %s", server.Name())
+	}
+	if server.SpanKind() != trace.SpanKindServer {
+		t.Errorf("Expected server span kind, got %v", server.SpanKind())
+	}
+	if server.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("Expected incoming trace id to be continued, got %s", server.SpanContext().TraceID())
+	}
+	if handler.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Errorf("Expected handler span to be a child of the server span")
+	}
+}
@@ -0,0 +1,90 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"net/url"
+	"strings"
+)
+
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOtlp   = "otlp"
+)
+
+const defaultOtlpPath = "/v1/traces"
+
+type Config struct {
+	ServiceName string
+	Exporter    string
+	Endpoint    string
+	// SampleRatio is the share of traces sampled, all of them when unset.
+	SampleRatio *float64
+}
+
+// Setup installs the global tracer provider and the W3C trace context
+// propagator. The returned function flushes and stops the exporter.
+func Setup(ctx context.Context, config Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	ratio, err := sampleRatio(config.SampleRatio)
+	if err != nil {
+		return nil, err
+	}
+	exporter, err := newExporter(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	if exporter == nil {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(config.ServiceName))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+func sampleRatio(configured *float64) (float64, error) {
+	if configured == nil {
+		return 1, nil
+	}
+	if *configured < 0 || *configured > 1 {
+		return 0, fmt.Errorf("tracing sample ratio must be between 0 and 1, got %v", *configured)
+	}
+	return *configured, nil
+}
+
+func newExporter(ctx context.Context, config Config) (sdktrace.SpanExporter, error) {
+	switch strings.ToLower(config.Exporter) {
+	case "", ExporterNone:
+		return nil, nil
+	case ExporterStdout:
+		return stdouttrace.New()
+	case ExporterOtlp:
+		if config.Endpoint == "" {
+			return nil, fmt.Errorf("otlp exporter requires an endpoint")
+		}
+		endpoint, err := url.Parse(config.Endpoint)
+		if err != nil || endpoint.Host == "" {
+			return nil, fmt.Errorf("invalid otlp endpoint %q", config.Endpoint)
+		}
+		if endpoint.Path == "" || endpoint.Path == "/" {
+			endpoint.Path = defaultOtlpPath
+		}
+		return otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint.String()))
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", config.Exporter)
+	}
+}
@@ -0,0 +1,80 @@
+package tracing
+
+import (
+	"context"
+	"go.opentelemetry.io/otel"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSetupWithoutExporterIsNoop(t *testing.T) {
+	shutdown, err := Setup(context.Background(), Config{ServiceName: "test"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Errorf("Expected no error on shutdown, got %v", err)
+	}
+}
+
+func TestSetupRejectsUnknownExporter(t *testing.T) {
+	_, err := Setup(context.Background(), Config{Exporter: "carrier-pigeon"})
+	if err == nil {
+		t.Errorf("Expected error for unknown exporter, got nil")
+	}
+}
+
+func TestSetupRejectsOtlpWithoutEndpoint(t *testing.T) {
+	_, err := Setup(context.Background(), Config{Exporter: ExporterOtlp})
+	if err == nil {
+		t.Errorf("Expected error for otlp exporter without endpoint, got nil")
+	}
+}
+
+func TestSetupExportsSpansToOtlpCollector(t *testing.T) {
+	var received atomic.Int32
+	var path atomic.Value
+	collector := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, r *http.Request) {
+		path.Store(r.URL.Path)
+		received.Add(1)
+		writer.WriteHeader(http.StatusOK)
+	}))
+	defer collector.Close()
+
+	shutdown, err := Setup(context.Background(), Config{ServiceName: "test", Exporter: ExporterOtlp, Endpoint: collector.URL})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	_, span := otel.Tracer("test").Start(context.Background(), "operation")
+	span.End()
+
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("Expected no error on shutdown, got %v", err)
+	}
+	if received.Load() == 0 {
+		t.Fatalf("Expected collector to receive spans")
+	}
+	if path.Load() != defaultOtlpPath {
+		t.Errorf("Expected spans to be posted to %s, got %v", defaultOtlpPath, path.Load())
+	}
+}
+
+func TestSampleRatioDefaultsOnlyWhenUnset(t *testing.T) {
+	zero, half, tooMuch := 0.0, 0.5, 1.5
+
+	if ratio, err := sampleRatio(nil); err != nil || ratio != 1 {
+		t.Errorf("Expected 1 when unset, got %v %v", ratio, err)
+	}
+	if ratio, err := sampleRatio(&zero); err != nil || ratio != 0 {
+		t.Errorf("Expected 0 to sample nothing, got %v %v", ratio, err)
+	}
+	if ratio, err := sampleRatio(&half); err != nil || ratio != 0.5 {
+		t.Errorf("Expected 0.5, got %v %v", ratio, err)
+	}
+	if _, err := sampleRatio(&tooMuch); err == nil {
+		t.Errorf("Expected error for a ratio above 1, got nil")
+	}
+}
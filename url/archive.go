@@ -0,0 +1,263 @@
+package url
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"html"
+	"net/http"
+	"slices"
+	"thesilentcoder.com/m/archive"
+	"thesilentcoder.com/m/fetch"
+	"thesilentcoder.com/m/repository"
+	"time"
+)
+
+// archiveSandbox keeps archived pages from running scripts or reaching our
+// cookies; they are third-party HTML served from our origin.
+const archiveSandbox = "sandbox; default-src 'none'; img-src http: https: data:; style-src http: https: 'unsafe-inline'; font-src http: https: data:"
+
+const (
+	// archivePath is the path under a short link its snapshots are served at.
+	// Passthrough never forwards it.
+	archivePath = "archive"
+	// maxSnapshots is how many snapshots a link keeps, the oldest go first.
+	maxSnapshots = 20
+	// pruneInterval is how often snapshots no link refers to are removed.
+	pruneInterval = time.Hour
+	// pruneGrace keeps snapshots that were just stored from being pruned
+	// before the link that took them records them.
+	pruneGrace = time.Hour
+)
+
+// Snapshot is a copy of the destination as it was at FetchedAt.
+type Snapshot struct {
+	Digest      string    `json:"digest"`
+	Url         string    `json:"url"`
+	Status      int       `json:"status"`
+	ContentType string    `json:"content_type,omitempty"`
+	Truncated   bool      `json:"truncated,omitempty"`
+	FetchedAt   time.Time `json:"fetched_at"`
+}
+
+// Archiver takes snapshots of the destinations of links created with archiving
+// enabled, when they are created and every interval after that.
+type Archiver struct {
+	repository repository.Repository[Url]
+	store      *archive.Store
+	client     *fetch.Client
+	interval   time.Duration
+	now        func() time.Time
+	prunedAt   time.Time
+}
+
+func NewArchiver(repository repository.Repository[Url], store *archive.Store, client *fetch.Client, interval time.Duration) *Archiver {
+	return &Archiver{repository: repository, store: store, client: client, interval: interval, now: time.Now}
+}
+
+// Run takes the snapshots that are due every minute, when an interval is
+// configured, and prunes the store every pruneInterval until ctx is done.
+func (a *Archiver) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		if a.interval > 0 {
+			a.snapshotDue(ctx)
+		}
+		if now := a.now(); now.Sub(a.prunedAt) >= pruneInterval {
+			a.prunedAt = now
+			a.prune(ctx)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (a *Archiver) snapshotDue(ctx context.Context) {
+	links, err := a.repository.List(ctx)
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("Failed to list links for snapshots")
+		return
+	}
+	now := a.now()
+	for _, link := range links {
+		if ctx.Err() != nil {
+			return
+		}
+		if !link.Archive || now.Before(link.ArchivedAt.Add(a.interval)) {
+			continue
+		}
+		if err := a.snapshot(ctx, link.Id); err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Str("short_code", link.Shortened).Msg("Failed to take snapshot")
+		}
+	}
+}
+
+// prune removes the stored snapshots no link refers to any more, those of
+// deleted links and those that fell out of maxSnapshots.
+func (a *Archiver) prune(ctx context.Context) {
+	links, err := a.repository.List(ctx)
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("Failed to list links for pruning snapshots")
+		return
+	}
+	referenced := make(map[string]bool)
+	for _, link := range links {
+		for _, snapshot := range link.Snapshots {
+			referenced[snapshot.Digest] = true
+		}
+	}
+	removed, err := a.store.Prune(func(digest string) bool { return referenced[digest] }, a.now().Add(-pruneGrace))
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("Failed to prune snapshots")
+	}
+	if removed > 0 {
+		zerolog.Ctx(ctx).Info().Int("removed", removed).Msg("Pruned snapshots")
+	}
+}
+
+// snapshot fetches the destination of the link with the given id and adds it
+// to the link's snapshots when its content changed since the last one,
+// dropping the oldest beyond maxSnapshots.
+func (a *Archiver) snapshot(ctx context.Context, id int) error {
+	link, err := a.repository.GetById(ctx, id)
+	if err != nil || link == nil {
+		return fmt.Errorf("url with id %d not found", id)
+	}
+	page, fetchErr := a.client.Get(ctx, link.Original)
+	var snapshot *Snapshot
+	switch {
+	case fetchErr != nil:
+	case page.Status >= http.StatusBadRequest:
+		fetchErr = fmt.Errorf("destination answered %d", page.Status)
+	case !isHtml(page.ContentType):
+		fetchErr = fmt.Errorf("destination is %s, not HTML", page.ContentType)
+	}
+	if fetchErr == nil {
+		digest, err := a.store.Put(page.Body)
+		if err != nil {
+			return err
+		}
+		snapshot = &Snapshot{
+			Digest:      digest,
+			Url:         page.Url,
+			Status:      page.Status,
+			ContentType: page.ContentType,
+			Truncated:   page.Truncated,
+			FetchedAt:   a.now().UTC(),
+		}
+	}
+
+	archivedAt := a.now().UTC()
+	_, err = a.repository.Modify(ctx, id, func(stored *Url) {
+		stored.ArchivedAt = archivedAt
+		if latest := stored.latestSnapshot(); snapshot != nil && (latest == nil || latest.Digest != snapshot.Digest) {
+			snapshots := append(slices.Clone(stored.Snapshots), *snapshot)
+			stored.Snapshots = snapshots[max(0, len(snapshots)-maxSnapshots):]
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return fetchErr
+}
+
+func (u *Url) latestSnapshot() *Snapshot {
+	if len(u.Snapshots) == 0 {
+		return nil
+	}
+	return &u.Snapshots[len(u.Snapshots)-1]
+}
+
+func (u *Url) archiveUrl() string {
+	return u.Url + "/" + archivePath
+}
+
+// archivingOver reports whether visits go to the latest snapshot because the
+// destination is failing and the link has no fallback destination.
+func (s Service) archivingOver(link *Url) bool {
+	return link.ArchiveWhenDead && s.archiver != nil && link.latestSnapshot() != nil &&
+		link.Liveness.FailureStreak >= s.failoverThreshold
+}
+
+// snapshotLater takes the first snapshot of a new link in the background.
+func (s Service) snapshotLater(ctx context.Context, link *Url) {
+	if s.archiver == nil || !link.Archive {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		if err := s.archiver.snapshot(ctx, link.Id); err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Str("short_code", link.Shortened).Msg("Failed to take snapshot")
+		}
+	}()
+}
+
+// handleArchive serves the latest snapshot of a link, or the one named by the
+// snapshot parameter.
+func (s Service) handleArchive(writer http.ResponseWriter, r *http.Request) {
+	link, err := s.repository.GetByValue(r.Context(), mux.Vars(r)["shortened"])
+	if err != nil || s.archiver == nil {
+		http.Error(writer, "Snapshot not found", http.StatusNotFound)
+		return
+	}
+	if s.refuseUnavailable(writer, r, link) || s.refuseBlocked(writer, r, link, link.Original) {
+		return
+	}
+
+	snapshot := link.latestSnapshot()
+	if digest := r.URL.Query().Get("snapshot"); digest != "" {
+		snapshot = nil
+		for i := range link.Snapshots {
+			if link.Snapshots[i].Digest == digest {
+				snapshot = &link.Snapshots[i]
+			}
+		}
+	}
+	if snapshot == nil {
+		http.Error(writer, "Snapshot not found", http.StatusNotFound)
+		return
+	}
+	if s.refuseBlocked(writer, r, link, snapshot.Url) {
+		return
+	}
+	content, err := s.archiver.store.Get(snapshot.Digest)
+	if err != nil {
+		zerolog.Ctx(r.Context()).Error().Err(err).Str("digest", snapshot.Digest).Msg("Failed to read snapshot")
+		http.Error(writer, "Snapshot not found", http.StatusNotFound)
+		return
+	}
+
+	contentType := snapshot.ContentType
+	if contentType == "" {
+		contentType = "text/html; charset=utf-8"
+	}
+	if isHtml(contentType) {
+		content = withBase(content, snapshot.Url)
+	}
+	writer.Header().Set("Content-Type", contentType)
+	writer.Header().Set("Content-Security-Policy", archiveSandbox)
+	writer.Header().Set("X-Content-Type-Options", "nosniff")
+	writer.Header().Set("Cache-Control", "no-store")
+	writer.Header().Set("Memento-Datetime", snapshot.FetchedAt.Format(http.TimeFormat))
+	writer.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"original\"", snapshot.Url))
+	_, _ = writer.Write(content)
+}
+
+// withBase makes the relative references of an archived page resolve against
+// where it was fetched from instead of the archive URL.
+func withBase(content []byte, base string) []byte {
+	tag := []byte(`<base href="` + html.EscapeString(base) + `">`)
+	if head := bytes.Index(bytes.ToLower(content), []byte("<head")); head >= 0 {
+		if end := bytes.IndexByte(content[head:], '>'); end >= 0 {
+			at := head + end + 1
+			return append(append(append([]byte(nil), content[:at]...), tag...), content[at:]...)
+		}
+	}
+	return append(tag, content...)
+}
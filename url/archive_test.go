@@ -0,0 +1,290 @@
+package url
+
+import (
+	"context"
+	"errors"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"thesilentcoder.com/m/archive"
+	"thesilentcoder.com/m/domainpolicy"
+	"thesilentcoder.com/m/fetch"
+	"time"
+)
+
+func newArchiveFixture(t *testing.T, page *string) (*Archiver, *mockRepository, *httptest.Server) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, _ *http.Request) {
+		writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = writer.Write([]byte(*page))
+	}))
+	t.Cleanup(server.Close)
+	store, err := archive.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	repo := newMockRepository()
+	repo.urls[0] = &Url{Id: 0, Original: server.URL + "/terms", Shortened: "abc", Url: "http://localhost:8080/abc", Archive: true}
+	archiver := NewArchiver(repo, store, fetch.New(fetch.Config{AllowPrivateNetworks: true}), time.Hour)
+	return archiver, repo, server
+}
+
+func TestSnapshotStoresChangedContentOnly(t *testing.T) {
+	page := "<html><head><title>v1</title></head></html>"
+	archiver, repo, _ := newArchiveFixture(t, &page)
+
+	for _, content := range []string{page, page, "<html><head><title>v2</title></head></html>"} {
+		page = content
+		if err := archiver.snapshot(context.Background(), 0); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	snapshots := repo.urls[0].Snapshots
+	if len(snapshots) != 2 {
+		t.Fatalf("Expected 2 distinct snapshots, got %d", len(snapshots))
+	}
+	content, err := archiver.store.Get(snapshots[1].Digest)
+	if err != nil || !strings.Contains(string(content), "v2") {
+		t.Errorf("Expected latest content in the store, got %q (%v)", content, err)
+	}
+}
+
+func TestSnapshotDueHonoursInterval(t *testing.T) {
+	page := "<html></html>"
+	archiver, repo, server := newArchiveFixture(t, &page)
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	archiver.now = func() time.Time { return now }
+	repo.urls[0].ArchivedAt = now.Add(-30 * time.Minute)
+	repo.urls[1] = &Url{Id: 1, Original: server.URL, Shortened: "def"}
+
+	archiver.snapshotDue(context.Background())
+	if len(repo.urls[0].Snapshots) != 0 || len(repo.urls[1].Snapshots) != 0 {
+		t.Fatalf("Expected no snapshots before the interval passed")
+	}
+
+	now = now.Add(time.Hour)
+	archiver.snapshotDue(context.Background())
+	if len(repo.urls[0].Snapshots) != 1 || len(repo.urls[1].Snapshots) != 0 {
+		t.Errorf("Expected only the archived link to get a snapshot, got %d and %d", len(repo.urls[0].Snapshots), len(repo.urls[1].Snapshots))
+	}
+}
+
+func TestHandleArchiveServesSandboxedSnapshot(t *testing.T) {
+	page := "<html><HEAD><title>Terms</title></HEAD><body><img src=\"logo.png\"></body></html>"
+	archiver, repo, server := newArchiveFixture(t, &page)
+	if err := archiver.snapshot(context.Background(), 0); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	service := New(repo, ":8080", "http://localhost", "api", 1, WithArchiver(archiver))
+
+	req := httptest.NewRequest(http.MethodGet, "/abc/archive", nil)
+	req = mux.SetURLVars(req, map[string]string{"shortened": "abc"})
+	w := httptest.NewRecorder()
+	service.handleArchive(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Security-Policy"), "sandbox") {
+		t.Errorf("Expected sandboxing CSP, got %q", w.Header().Get("Content-Security-Policy"))
+	}
+	if expected := `<HEAD><base href="` + server.URL + `/terms">`; !strings.Contains(w.Body.String(), expected) {
+		t.Errorf("Expected base reference in %s", w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/abc/archive?snapshot=unknown", nil)
+	req = mux.SetURLVars(req, map[string]string{"shortened": "abc"})
+	w = httptest.NewRecorder()
+	service.handleArchive(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown snapshot, got %d", w.Code)
+	}
+}
+
+func TestRedirectGoesToArchiveWhenDestinationIsDead(t *testing.T) {
+	page := "<html></html>"
+	archiver, repo, _ := newArchiveFixture(t, &page)
+	if err := archiver.snapshot(context.Background(), 0); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	repo.urls[0].ArchiveWhenDead = true
+	repo.urls[0].Redirect = RedirectPolicy{Status: http.StatusMovedPermanently, Cache: CachePublic, MaxAge: 3600}
+	repo.urls[0].Liveness.FailureStreak = defaultFailoverThreshold
+	service := New(repo, ":8080", "http://localhost", "api", 1, WithArchiver(archiver))
+
+	req := httptest.NewRequest(http.MethodGet, "/abc/", nil)
+	req = mux.SetURLVars(req, map[string]string{"shortened": "abc"})
+	w := httptest.NewRecorder()
+	service.handleUrlRedirect(w, req)
+
+	if location := w.Header().Get("Location"); location != "http://localhost:8080/abc/archive" {
+		t.Errorf("Expected redirect to the archive, got %s", location)
+	}
+	if w.Code != http.StatusFound || w.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("Expected an uncached 302, got %d %s", w.Code, w.Header().Get("Cache-Control"))
+	}
+	if breakdown := service.visits.breakdown(0)[dimensionFailover]; breakdown["archive"] != 1 {
+		t.Errorf("Expected archive visit to be recorded, got %v", breakdown)
+	}
+}
+
+func TestHandleUrlShortenWithoutArchiver(t *testing.T) {
+	service := New(newMockRepository(), ":8080", "http://localhost", "api", 1)
+
+	w := httptest.NewRecorder()
+	service.handleUrlShorten(w, newShortenRequest(t, ShortLink{Url: "https://example.com", Archive: true}))
+
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("Expected status 501, got %d", w.Code)
+	}
+}
+
+func TestRegisterHandlersRoutesArchiveBeforePassthrough(t *testing.T) {
+	page := "<html></html>"
+	archiver, repo, _ := newArchiveFixture(t, &page)
+	if err := archiver.snapshot(context.Background(), 0); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	repo.urls[0].Passthrough = Passthrough{Path: true}
+	repo.urls[0].Redirect = RedirectPolicy{Status: http.StatusPermanentRedirect}
+	router := mux.NewRouter()
+	New(repo, ":8080", "http://localhost", "api", 1, WithArchiver(archiver)).RegisterHandlers(router)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/abc/archive", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Memento-Datetime") == "" {
+		t.Errorf("Expected the snapshot, got %d %s", w.Code, w.Header().Get("Location"))
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/abc/archive", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected the archive path not to be passed through, got %d %s", w.Code, w.Header().Get("Location"))
+	}
+}
+
+func TestSnapshotKeepsAtMostMaxSnapshots(t *testing.T) {
+	page := ""
+	archiver, repo, _ := newArchiveFixture(t, &page)
+
+	for i := range maxSnapshots + 3 {
+		page = "<html>" + strconv.Itoa(i) + "</html>"
+		if err := archiver.snapshot(context.Background(), 0); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	snapshots := repo.urls[0].Snapshots
+	if len(snapshots) != maxSnapshots {
+		t.Fatalf("Expected %d snapshots, got %d", maxSnapshots, len(snapshots))
+	}
+	if content, _ := archiver.store.Get(snapshots[0].Digest); string(content) != "<html>3</html>" {
+		t.Errorf("Expected the oldest snapshots to be dropped, got %s", content)
+	}
+}
+
+func TestPruneRemovesUnreferencedSnapshots(t *testing.T) {
+	page := "<html>kept</html>"
+	archiver, repo, _ := newArchiveFixture(t, &page)
+	_ = archiver.snapshot(context.Background(), 0)
+	kept := repo.urls[0].Snapshots[0].Digest
+	repo.urls[1] = &Url{Id: 1, Original: repo.urls[0].Original, Shortened: "def", Archive: true}
+	page = "<html>deleted</html>"
+	_ = archiver.snapshot(context.Background(), 1)
+	deleted := repo.urls[1].Snapshots[0].Digest
+	delete(repo.urls, 1)
+
+	archiver.now = func() time.Time { return time.Now().Add(2 * pruneGrace) }
+	archiver.prune(context.Background())
+
+	if _, err := archiver.store.Get(kept); err != nil {
+		t.Errorf("Expected the referenced snapshot to be kept, got %v", err)
+	}
+	if _, err := archiver.store.Get(deleted); !errors.Is(err, archive.ErrNotFound) {
+		t.Errorf("Expected the deleted link's snapshot to be pruned, got %v", err)
+	}
+}
+
+func TestHandleArchiveRefusesUnavailableLinks(t *testing.T) {
+	page := "<html></html>"
+	archiver, repo, _ := newArchiveFixture(t, &page)
+	if err := archiver.snapshot(context.Background(), 0); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	now := time.Now()
+	cases := map[string]struct {
+		modify   func(*Url)
+		blocked  string
+		expected int
+	}{
+		"expired":        {modify: func(u *Url) { u.ExpiresAt = now.Add(-time.Minute) }, expected: http.StatusGone},
+		"not yet active": {modify: func(u *Url) { u.NotBefore = now.Add(time.Hour) }, expected: http.StatusServiceUnavailable},
+		"blocked":        {modify: func(*Url) {}, blocked: "127.0.0.1\n", expected: http.StatusGone},
+	}
+	for name, c := range cases {
+		link := *repo.urls[0]
+		c.modify(&link)
+		caseRepo := newMockRepository()
+		caseRepo.urls[0] = &link
+		options := []Option{WithArchiver(archiver)}
+		if c.blocked != "" {
+			blocklist := filepath.Join(t.TempDir(), "blocklist.txt")
+			_ = os.WriteFile(blocklist, []byte(c.blocked), 0o600)
+			policy, err := domainpolicy.Load(blocklist, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			options = append(options, WithDomainPolicy(policy))
+		}
+		router := mux.NewRouter()
+		New(caseRepo, ":8080", "http://localhost", "api", 1, options...).RegisterHandlers(router)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/abc/archive", nil))
+		if w.Code != c.expected {
+			t.Errorf("Expected status %d for a %s link, got %d", c.expected, name, w.Code)
+		}
+	}
+}
+
+func TestSnapshotSkipsContentThatIsNotHtml(t *testing.T) {
+	page := ""
+	archiver, repo, _ := newArchiveFixture(t, &page)
+	pdf := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, _ *http.Request) {
+		writer.Header().Set("Content-Type", "application/pdf")
+		_, _ = writer.Write([]byte("%PDF-1.7"))
+	}))
+	defer pdf.Close()
+	repo.urls[0].Original = pdf.URL
+
+	if err := archiver.snapshot(context.Background(), 0); err == nil {
+		t.Errorf("Expected an error for a PDF destination")
+	}
+	if len(repo.urls[0].Snapshots) != 0 {
+		t.Errorf("Expected no snapshot of a PDF, got %v", repo.urls[0].Snapshots)
+	}
+}
+
+func TestRunPrunesWithoutSnapshotInterval(t *testing.T) {
+	page := "<html>deleted</html>"
+	archiver, repo, _ := newArchiveFixture(t, &page)
+	_ = archiver.snapshot(context.Background(), 0)
+	deleted := repo.urls[0].Snapshots[0].Digest
+	delete(repo.urls, 0)
+	archiver.interval = 0
+	archiver.now = func() time.Time { return time.Now().Add(2 * pruneGrace) }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	archiver.Run(ctx)
+
+	if _, err := archiver.store.Get(deleted); !errors.Is(err, archive.ErrNotFound) {
+		t.Errorf("Expected the deleted link's snapshot to be pruned, got %v", err)
+	}
+}
@@ -0,0 +1,155 @@
+package url
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"thesilentcoder.com/m/useragent"
+)
+
+// fallbackDelay is how long the launch page waits for the app to open before
+// sending the visitor to the web fallback.
+const fallbackDelay = 1500
+
+var unsafeSchemes = []string{"javascript", "data", "vbscript", "file", "blob"}
+
+// DeepLink opens a mobile app instead of the web destination. Ios may be a
+// universal link or a custom scheme URL, Android an app link, an intent URL
+// or a custom scheme URL. Fallback is where visitors without the app end up
+// and defaults to the link's destination.
+type DeepLink struct {
+	Ios      string `json:"ios,omitempty"`
+	Android  string `json:"android,omitempty"`
+	Fallback string `json:"fallback,omitempty"`
+}
+
+type deepLinkPage struct {
+	AppUrl        template.URL
+	Fallback      string
+	FallbackDelay int
+}
+
+func (d DeepLink) IsZero() bool {
+	return d == DeepLink{}
+}
+
+func (d DeepLink) validate() error {
+	if d.IsZero() {
+		return nil
+	}
+	if d.Ios == "" && d.Android == "" {
+		return fmt.Errorf("deep_link needs an ios or android target")
+	}
+	if err := validateAppUrl(d.Ios, false); err != nil {
+		return fmt.Errorf("invalid ios deep link: %w", err)
+	}
+	if err := validateAppUrl(d.Android, true); err != nil {
+		return fmt.Errorf("invalid android deep link: %w", err)
+	}
+	if d.Fallback != "" && !isWebUrl(d.Fallback) {
+		return fmt.Errorf("deep link fallback must be an http or https URL")
+	}
+	return nil
+}
+
+func validateAppUrl(value string, intentAllowed bool) error {
+	if value == "" {
+		return nil
+	}
+	parsed, err := url.Parse(value)
+	if err != nil || parsed.Scheme == "" {
+		return fmt.Errorf("%q is not an absolute URL", value)
+	}
+	scheme := strings.ToLower(parsed.Scheme)
+	switch {
+	case scheme == "http" || scheme == "https":
+		if parsed.Host == "" {
+			return fmt.Errorf("%q has no host", value)
+		}
+	case scheme == "intent":
+		if !intentAllowed {
+			return fmt.Errorf("intent URLs only work on android")
+		}
+		if !strings.Contains(value, "#Intent;") || !strings.HasSuffix(value, ";end") {
+			return fmt.Errorf("%q is not a valid intent URL", value)
+		}
+	case slices.Contains(unsafeSchemes, scheme):
+		return fmt.Errorf("scheme %s is not allowed", scheme)
+	}
+	return nil
+}
+
+func isWebUrl(value string) bool {
+	parsed, err := url.Parse(value)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
+
+// appUrl returns the deep link for the visitor's platform, if there is one.
+func (d DeepLink) appUrl(agent useragent.Agent) string {
+	if agent.Device == useragent.DeviceBot {
+		return ""
+	}
+	switch agent.Os {
+	case useragent.OsIos:
+		return d.Ios
+	case useragent.OsAndroid:
+		return d.Android
+	}
+	return ""
+}
+
+// withBrowserFallback adds fallback to an intent URL so that Chrome opens it
+// itself when the app is not installed.
+func withBrowserFallback(intent string, fallback string) string {
+	if strings.Contains(intent, ";S.browser_fallback_url=") {
+		return intent
+	}
+	return strings.TrimSuffix(intent, "end") + "S.browser_fallback_url=" + url.QueryEscape(fallback) + ";end"
+}
+
+// refuseBlockedApp is refuseBlocked for where openApp would send the visitor:
+// a universal or app link, or the fallback of the launch page.
+func (s Service) refuseBlockedApp(writer http.ResponseWriter, r *http.Request, link *Url) bool {
+	appUrl := link.DeepLink.appUrl(useragent.Parse(r.UserAgent()))
+	switch {
+	case appUrl == "":
+		return false
+	case isWebUrl(appUrl):
+		return s.refuseBlocked(writer, r, link, appUrl)
+	}
+	return link.DeepLink.Fallback != "" && s.refuseBlocked(writer, r, link, link.DeepLink.Fallback)
+}
+
+// openApp sends mobile visitors to the link's app. Universal and app links are
+// plain redirects, as the OS decides whether the app handles them; custom
+// schemes and intents get a launch page that falls back to the web after a
+// short delay. It reports whether it handled the request.
+func (s Service) openApp(writer http.ResponseWriter, r *http.Request, link *Url, destination string) bool {
+	appUrl := link.DeepLink.appUrl(useragent.Parse(r.UserAgent()))
+	if appUrl == "" {
+		return false
+	}
+	if isWebUrl(appUrl) {
+		link.Redirect.Redirect(writer, r, appUrl)
+		return true
+	}
+
+	fallback := link.DeepLink.Fallback
+	if fallback == "" {
+		fallback = destination
+	}
+	if strings.HasPrefix(strings.ToLower(appUrl), "intent:") {
+		appUrl = withBrowserFallback(appUrl, fallback)
+	}
+	s.renderPage(writer, r, "deep_link.html", http.StatusOK, deepLinkPage{
+		// The URL was checked against unsafe schemes when the link was
+		// created, custom app schemes would otherwise be filtered out.
+		AppUrl:        template.URL(appUrl),
+		Fallback:      fallback,
+		FallbackDelay: fallbackDelay,
+	})
+	return true
+}
@@ -0,0 +1,91 @@
+package url
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDeepLinkRedirectsToUniversalLink(t *testing.T) {
+	service, _ := newRedirectService(&Url{Id: 0, Original: "https://example.com/item/1", Shortened: "app", DeepLink: DeepLink{Ios: "https://app.example.com/item/1"}})
+
+	w := visit(t, service, "app", withHeader("User-Agent", iphoneAgent))
+
+	if location := w.Header().Get("Location"); location != "https://app.example.com/item/1" {
+		t.Errorf("Expected redirect to universal link, got %d %s", w.Code, location)
+	}
+}
+
+func TestDeepLinkServesLaunchPageForCustomScheme(t *testing.T) {
+	service, _ := newRedirectService(&Url{Id: 0, Original: "https://example.com/item/1", Shortened: "app", DeepLink: DeepLink{Ios: "exampleapp://item/1", Fallback: "https://example.com/download"}})
+
+	w := visit(t, service, "app", withHeader("User-Agent", iphoneAgent))
+
+	body := w.Body.String()
+	if w.Code != http.StatusOK || !strings.Contains(body, `"exampleapp://item/1"`) {
+		t.Fatalf("Expected launch page for the app, got %d %s", w.Code, body)
+	}
+	if !strings.Contains(body, `"https://example.com/download"`) {
+		t.Errorf("Expected fallback in launch page, got %s", body)
+	}
+}
+
+func TestDeepLinkAddsBrowserFallbackToIntent(t *testing.T) {
+	service, _ := newRedirectService(&Url{Id: 0, Original: "https://example.com/item/1", Shortened: "app", DeepLink: DeepLink{Android: "intent://item/1#Intent;scheme=exampleapp;package=com.example.app;end"}})
+
+	w := visit(t, service, "app", withHeader("User-Agent", androidAgent))
+
+	if !strings.Contains(w.Body.String(), "S.browser_fallback_url=https%3A%2F%2Fexample.com%2Fitem%2F1;end") {
+		t.Errorf("Expected intent with browser fallback, got %s", w.Body.String())
+	}
+}
+
+func TestDeepLinkLeavesDesktopVisitorsOnTheWeb(t *testing.T) {
+	service, _ := newRedirectService(&Url{Id: 0, Original: "https://example.com/item/1", Shortened: "app", DeepLink: DeepLink{Ios: "exampleapp://item/1", Android: "exampleapp://item/1"}})
+
+	w := visit(t, service, "app", withHeader("User-Agent", desktopAgent))
+
+	if location := w.Header().Get("Location"); location != "https://example.com/item/1" {
+		t.Errorf("Expected web redirect, got %d %s", w.Code, location)
+	}
+}
+
+func TestDeepLinkValidate(t *testing.T) {
+	cases := map[string]bool{
+		"exampleapp://item/1":                          true,
+		"javascript:alert(1)":                          false,
+		"intent://item/1#Intent;scheme=exampleapp;end": false,
+		"/relative":                                    false,
+		"https://example.com":                          true,
+	}
+	for ios, valid := range cases {
+		err := DeepLink{Ios: ios}.validate()
+
+		if (err == nil) != valid {
+			t.Errorf("Expected valid=%v for %s, got %v", valid, ios, err)
+		}
+	}
+	if err := (DeepLink{Fallback: "https://example.com"}).validate(); err == nil {
+		t.Errorf("Expected a fallback alone to be rejected")
+	}
+}
+
+func TestDeepLinkRefusesBlockedAppTargets(t *testing.T) {
+	for _, deepLink := range []DeepLink{
+		{Ios: "https://app.evil.com/item/1"},
+		{Ios: "exampleapp://item/1", Fallback: "https://evil.com/download"},
+	} {
+		repo := newMockRepository()
+		repo.urls[0] = &Url{Id: 0, Original: "https://example.com/item/1", Shortened: "app", DeepLink: deepLink}
+		service, _ := newBlocklistService(t, repo, ".evil.com\n")
+
+		w := visit(t, service, "app", withHeader("User-Agent", iphoneAgent))
+
+		if w.Code != http.StatusGone {
+			t.Errorf("Expected status 410 for %+v, got %d", deepLink, w.Code)
+		}
+		if repo.urls[0].Visits != 0 {
+			t.Errorf("Expected refused visit not to be recorded for %+v", deepLink)
+		}
+	}
+}
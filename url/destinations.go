@@ -0,0 +1,124 @@
+package url
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"thesilentcoder.com/m/domainpolicy"
+)
+
+const maxSelfHops = 5
+
+var defaultSchemes = []string{"http", "https"}
+
+// destinations lists every web URL a link may send visitors to. The app URLs
+// of deep links are left out, they use schemes of their own.
+func (u *Url) destinations() []string {
+	result := []string{u.Original}
+	for _, rule := range u.Rules {
+		result = append(result, rule.Destination)
+	}
+	for _, variant := range u.Variants {
+		result = append(result, variant.Destination)
+	}
+	for _, window := range u.Schedule {
+		result = append(result, window.Destination)
+	}
+	if u.Fallback != "" {
+		result = append(result, u.Fallback)
+	}
+	if u.DeepLink.Fallback != "" {
+		result = append(result, u.DeepLink.Fallback)
+	}
+	return result
+}
+
+// checkDestinations returns the first policy violation among the link's
+// destinations: a scheme that is not allowed, a domain the domain policy
+// refuses or a chain through our own short links that loops.
+func (s Service) checkDestinations(ctx context.Context, u *Url) error {
+	for _, destination := range u.destinations() {
+		if err := s.checkDestination(destination); err != nil {
+			return err
+		}
+	}
+	for _, appUrl := range []string{u.DeepLink.Ios, u.DeepLink.Android} {
+		if err := s.domains.CheckUrl(appUrl); err != nil {
+			return err
+		}
+	}
+	return s.checkChain(ctx, u, map[string]bool{u.Shortened: true}, 0)
+}
+
+// checkDestination checks the scheme and the domain of a single destination.
+func (s Service) checkDestination(destination string) error {
+	parsed, err := url.Parse(destination)
+	if err != nil {
+		return fmt.Errorf("invalid destination %q", destination)
+	}
+	if !slices.Contains(s.schemes, parsed.Scheme) {
+		return fmt.Errorf("scheme %s is not allowed", parsed.Scheme)
+	}
+	return s.domains.CheckUrl(destination)
+}
+
+// checkChain follows the destinations of link that point back at the
+// shortener. Every one of them has to resolve to an existing short link,
+// within maxSelfHops, without coming back to a code already on the path.
+func (s Service) checkChain(ctx context.Context, link *Url, path map[string]bool, hops int) error {
+	for _, destination := range link.destinations() {
+		if s.isExternal(destination) {
+			continue
+		}
+		code := shortCodeOf(destination)
+		if path[code] {
+			return fmt.Errorf("destination %s redirects back to %s", destination, link.Shortened)
+		}
+		if hops >= maxSelfHops {
+			return fmt.Errorf("destination %s goes through more than %d short links", destination, maxSelfHops)
+		}
+		next, err := s.repository.GetByValue(ctx, code)
+		if err != nil {
+			return fmt.Errorf("destination %s is not a short link", destination)
+		}
+		path[code] = true
+		err = s.checkChain(ctx, next, path, hops+1)
+		delete(path, code)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shortCodeOf returns the first path segment of a URL on the shortener.
+func shortCodeOf(destination string) string {
+	parsed, err := url.Parse(destination)
+	if err != nil {
+		return ""
+	}
+	code, _, _ := strings.Cut(strings.TrimPrefix(parsed.Path, "/"), "/")
+	return code
+}
+
+// refuseBlocked answers visits to destinations the domain policy no longer
+// accepts, so that newly blocked domains stop resolving. It reports whether
+// it did.
+func (s Service) refuseBlocked(writer http.ResponseWriter, r *http.Request, link *Url, destination string) bool {
+	err := s.domains.CheckUrl(destination)
+	if err == nil {
+		return false
+	}
+	zerolog.Ctx(r.Context()).Warn().Err(err).Str("short_code", link.Shortened).Msg("Refused redirect to blocked destination")
+	if errors.Is(err, domainpolicy.ErrBlocked) || errors.Is(err, domainpolicy.ErrNotAllowed) {
+		http.Error(writer, "This link has been disabled", http.StatusGone)
+	} else {
+		http.Error(writer, "Invalid destination", http.StatusInternalServerError)
+	}
+	return true
+}
@@ -0,0 +1,162 @@
+package url
+
+import (
+	"context"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"thesilentcoder.com/m/domainpolicy"
+)
+
+func newBlocklistService(t *testing.T, repo *mockRepository, rules string) (*Service, string) {
+	t.Helper()
+	blocklist := filepath.Join(t.TempDir(), "blocklist.txt")
+	if err := os.WriteFile(blocklist, []byte(rules), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := domainpolicy.Load(blocklist, "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return New(repo, ":8080", "http://localhost", "api", 1, WithDomainPolicy(policy)), blocklist
+}
+
+func TestHandleUrlShortenRejectsBlockedDomains(t *testing.T) {
+	service, _ := newBlocklistService(t, newMockRepository(), ".evil.com\n")
+	cases := []ShortLink{
+		{Url: "https://login.evil.com/bank"},
+		{Url: "https://example.com", Variants: []Variant{{Destination: "https://evil.com", Weight: 1}}},
+		{Url: "https://example.com", Rules: []TargetingRule{{Os: []string{"ios"}, Destination: "https://www.evil.com"}}},
+	}
+	for _, short := range cases {
+		w := httptest.NewRecorder()
+		service.handleUrlShorten(w, newShortenRequest(t, short))
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %+v, got %d", short, w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	service.handleUrlShorten(w, newShortenRequest(t, ShortLink{Url: "https://example.com"}))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 for an unblocked domain, got %d", w.Code)
+	}
+}
+
+func TestHandleUrlRedirectRefusesNewlyBlockedDomain(t *testing.T) {
+	repo := newMockRepository()
+	repo.urls[0] = &Url{Id: 0, Original: "https://example.com", Shortened: "abc"}
+	service, blocklist := newBlocklistService(t, repo, "other.org\n")
+
+	if err := os.WriteFile(blocklist, []byte("example.com\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.domains.Reload(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/abc/", nil)
+	req = mux.SetURLVars(req, map[string]string{"shortened": "abc"})
+	w := httptest.NewRecorder()
+	service.handleUrlRedirect(w, req)
+
+	if w.Code != http.StatusGone {
+		t.Errorf("Expected status 410, got %d", w.Code)
+	}
+	if repo.urls[0].Visits != 0 {
+		t.Errorf("Expected refused visit not to be counted, got %d", repo.urls[0].Visits)
+	}
+}
+
+func TestHandleUrlShortenRejectsDisallowedSchemes(t *testing.T) {
+	service := New(newMockRepository(), ":8080", "http://localhost", "api", 1)
+
+	for _, destination := range []string{"file://host/etc/passwd", "javascript://host/%0Aalert(1)", "ftp://example.com/file"} {
+		w := httptest.NewRecorder()
+		service.handleUrlShorten(w, newShortenRequest(t, ShortLink{Url: destination}))
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %s, got %d", destination, w.Code)
+		}
+	}
+}
+
+func TestWithAllowedSchemesReplacesDefaults(t *testing.T) {
+	service := New(newMockRepository(), ":8080", "http://localhost", "api", 1, WithAllowedSchemes([]string{"HTTPS"}))
+
+	w := httptest.NewRecorder()
+	service.handleUrlShorten(w, newShortenRequest(t, ShortLink{Url: "http://example.com"}))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected http to be refused, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	service.handleUrlShorten(w, newShortenRequest(t, ShortLink{Url: "https://example.com"}))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected https to be accepted, got %d", w.Code)
+	}
+}
+
+func TestHandleUrlShortenFollowsChainsThroughOwnCodes(t *testing.T) {
+	repo := newMockRepository()
+	next, _ := ShortenURL(2)
+	repo.urls[0] = &Url{Id: 0, Original: "https://example.com", Shortened: "x"}
+	repo.urls[1] = &Url{Id: 1, Original: "http://localhost:8080/" + next, Shortened: "y"}
+	service := New(repo, ":8080", "http://localhost", "api", 1)
+	cases := map[string]int{
+		"http://localhost:8080/x":           http.StatusOK,
+		"http://localhost:8080/y":           http.StatusBadRequest,
+		"http://localhost:8080/" + next:     http.StatusBadRequest,
+		"http://localhost:8080/unknown":     http.StatusBadRequest,
+		"http://localhost:8080/api/v1/urls": http.StatusBadRequest,
+	}
+	for destination, expected := range cases {
+		w := httptest.NewRecorder()
+		service.handleUrlShorten(w, newShortenRequest(t, ShortLink{Url: destination}))
+
+		if w.Code != expected {
+			t.Errorf("Expected status %d for %s, got %d: %s", expected, destination, w.Code, w.Body.String())
+		}
+		delete(repo.urls, 2)
+	}
+}
+
+func TestCheckChainLimitsHops(t *testing.T) {
+	repo := newMockRepository()
+	repo.urls[0] = &Url{Id: 0, Original: "https://example.com", Shortened: "c0"}
+	for i := 1; i <= maxSelfHops; i++ {
+		repo.urls[i] = &Url{Id: i, Original: "http://localhost:8080/c" + strconv.Itoa(i-1), Shortened: "c" + strconv.Itoa(i)}
+	}
+	service := New(repo, ":8080", "http://localhost", "api", 1)
+
+	link := &Url{Original: "http://localhost:8080/c" + strconv.Itoa(maxSelfHops), Shortened: "new"}
+	if err := service.checkDestinations(context.Background(), link); err == nil {
+		t.Errorf("Expected a chain longer than %d hops to be refused", maxSelfHops)
+	}
+}
+
+func TestCheckChainSeesThroughHostSpellings(t *testing.T) {
+	repo := newMockRepository()
+	service := New(repo, ":8080", "http://short.host", "api", 1)
+	for _, spelling := range []string{
+		"HTTP://SHORT.HOST:8080/self",
+		"http://short.host.:8080/self",
+		"http://Short.Host/self",
+	} {
+		if service.isExternal(spelling) {
+			t.Errorf("Expected %s to be on the shortener", spelling)
+		}
+		link := &Url{Original: spelling, Shortened: "self"}
+		if err := service.checkDestinations(context.Background(), link); err == nil {
+			t.Errorf("Expected the loop through %s to be refused", spelling)
+		}
+	}
+	if !service.isExternal("http://short.host.example/self") {
+		t.Errorf("Expected another host to be external")
+	}
+}
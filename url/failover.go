@@ -0,0 +1,35 @@
+package url
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+const (
+	dimensionFailover        = "failover"
+	defaultFailoverThreshold = 3
+)
+
+// failoverRedirect is used instead of the link's own policy while failing
+// over, which may allow clients to cache the redirect.
+var failoverRedirect = RedirectPolicy{Status: http.StatusFound, Cache: CacheNoStore}
+
+func validateFallback(fallback string) error {
+	if fallback == "" {
+		return nil
+	}
+	parsed, err := url.ParseRequestURI(fallback)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return fmt.Errorf("invalid fallback destination")
+	}
+	return nil
+}
+
+// failingOver reports whether visits to the link's Original go to its
+// Fallback instead. Like a circuit breaker it opens once the liveness probes
+// failed failoverThreshold times in a row, and closes again with the first
+// probe that succeeds.
+func (s Service) failingOver(link *Url) bool {
+	return link.Fallback != "" && link.Liveness.FailureStreak >= s.failoverThreshold
+}
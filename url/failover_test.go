@@ -0,0 +1,63 @@
+package url
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func failoverLink(streak int) *Url {
+	return &Url{Id: 0, Original: "https://example.com", Shortened: "abc", Fallback: "https://status.example.com", Liveness: Liveness{FailureStreak: streak}}
+}
+
+func TestRedirectFailsOverOnceThresholdIsReached(t *testing.T) {
+	cases := map[int]string{
+		0: "https://example.com",
+		2: "https://example.com",
+		3: "https://status.example.com",
+	}
+	for streak, expected := range cases {
+		service, _ := newRedirectService(failoverLink(streak))
+
+		w := visit(t, service, "abc")
+
+		if location := w.Header().Get("Location"); location != expected {
+			t.Errorf("Expected %s with a streak of %d, got %s", expected, streak, location)
+		}
+	}
+}
+
+func TestWithFailoverThresholdChangesThreshold(t *testing.T) {
+	service, _ := newRedirectService(failoverLink(1))
+	WithFailoverThreshold(1)(service)
+
+	w := visit(t, service, "abc")
+
+	if location := w.Header().Get("Location"); location != "https://status.example.com" {
+		t.Errorf("Expected fallback, got %s", location)
+	}
+}
+
+func TestRedirectRecordsFailoverVisits(t *testing.T) {
+	service, repo := newRedirectService(failoverLink(0))
+	visit(t, service, "abc")
+	repo.urls[0].Liveness.FailureStreak = 5
+	visit(t, service, "abc")
+	visit(t, service, "abc")
+
+	breakdown := service.visits.breakdown(0)[dimensionFailover]
+	if breakdown["primary"] != 1 || breakdown["fallback"] != 2 {
+		t.Errorf("Expected 1 primary and 2 fallback visits, got %v", breakdown)
+	}
+}
+
+func TestHandleUrlShortenRejectsInvalidFallback(t *testing.T) {
+	service := New(newMockRepository(), ":8080", "http://localhost", "api", 1)
+
+	w := httptest.NewRecorder()
+	service.handleUrlShorten(w, newShortenRequest(t, ShortLink{Url: "https://example.com", Fallback: "status page"}))
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+}
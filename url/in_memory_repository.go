@@ -1,16 +1,28 @@
 package url
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+	"sync"
+)
 
 type InMemoryRepository struct {
+	mu   sync.RWMutex
 	urls map[int]*Url
+	// next stays above every id ever inserted, so that the ids, and with
+	// them the short codes, of deleted links are not handed out again.
+	next int
 }
 
-func (r *InMemoryRepository) GetById(id int) (*Url, error) {
+func (r *InMemoryRepository) GetById(_ context.Context, id int) (*Url, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	return r.urls[id], nil
 }
 
-func (r *InMemoryRepository) GetByValue(shortened string) (*Url, error) {
+func (r *InMemoryRepository) GetByValue(_ context.Context, shortened string) (*Url, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	for _, url := range r.urls {
 		if url.Shortened == shortened {
 			return url, nil
@@ -19,24 +31,71 @@ func (r *InMemoryRepository) GetByValue(shortened string) (*Url, error) {
 	return nil, fmt.Errorf("could not find url with shortened value %s", shortened)
 }
 
-func (r *InMemoryRepository) Insert(item *Url) (*Url, error) {
+func (r *InMemoryRepository) Insert(_ context.Context, item *Url) (*Url, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	if item.Id == -1 {
-		item.Id = len(r.urls)
+		item.Id = max(r.next, len(r.urls))
 	}
 	r.urls[item.Id] = item
+	r.next = max(r.next, item.Id+1)
 	return item, nil
 }
 
-func (r *InMemoryRepository) Update(item *Url) error {
+func (r *InMemoryRepository) Update(_ context.Context, item *Url) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	if _, exists := r.urls[item.Id]; !exists {
-		return fmt.Errorf("url with id %d not found", item.Id)
+		return 0, fmt.Errorf("url with id %d not found", item.Id)
 	}
-	r.urls[item.Id].Visits += 1
+	updated := *r.urls[item.Id]
+	updated.Visits += 1
+	r.urls[item.Id] = &updated
+	return updated.Visits, nil
+}
+
+// Modify applies modify to a copy of the stored link and stores the copy, so
+// that links handed out earlier never change under their readers. modify
+// must replace slices rather than change their elements, as the copy shares
+// them with the stored link.
+func (r *InMemoryRepository) Modify(_ context.Context, id int, modify func(*Url)) (*Url, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, exists := r.urls[id]
+	if !exists {
+		return nil, fmt.Errorf("url with id %d not found", id)
+	}
+	modified := *stored
+	modify(&modified)
+	modified.Id = id
+	r.urls[id] = &modified
+	return &modified, nil
+}
+
+func (r *InMemoryRepository) Delete(_ context.Context, id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.urls[id]; !exists {
+		return fmt.Errorf("url with id %d not found", id)
+	}
+	delete(r.urls, id)
 	return nil
 }
 
-func (r *InMemoryRepository) Next() (int, error) {
-	return len(r.urls), nil
+func (r *InMemoryRepository) Next(_ context.Context) (int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return max(r.next, len(r.urls)), nil
+}
+
+func (r *InMemoryRepository) List(_ context.Context) ([]*Url, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	result := make([]*Url, 0, len(r.urls))
+	for _, url := range r.urls {
+		result = append(result, url)
+	}
+	return result, nil
 }
 
 func NewRepository() *InMemoryRepository {
@@ -1,6 +1,7 @@
 package url
 
 import (
+	"context"
 	"testing"
 )
 
@@ -9,7 +10,7 @@ func TestGetByIdReturnsExistingUrl(t *testing.T) {
 	url := &Url{Id: 1, Original: "https://example.com", Shortened: "abc"}
 	repo.urls[1] = url
 
-	result, err := repo.GetById(1)
+	result, err := repo.GetById(context.Background(), 1)
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
 	}
@@ -21,7 +22,7 @@ func TestGetByIdReturnsExistingUrl(t *testing.T) {
 func TestGetByIdReturnsNilForNonExistentId(t *testing.T) {
 	repo := NewRepository()
 
-	result, err := repo.GetById(999)
+	result, err := repo.GetById(context.Background(), 999)
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
 	}
@@ -35,7 +36,7 @@ func TestGetByValueReturnsUrlWithMatchingShortenedValue(t *testing.T) {
 	url := &Url{Id: 1, Original: "https://example.com", Shortened: "abc"}
 	repo.urls[1] = url
 
-	result, err := repo.GetByValue("abc")
+	result, err := repo.GetByValue(context.Background(), "abc")
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
 	}
@@ -47,7 +48,7 @@ func TestGetByValueReturnsUrlWithMatchingShortenedValue(t *testing.T) {
 func TestGetByValueReturnsErrorForNonExistentValue(t *testing.T) {
 	repo := NewRepository()
 
-	result, err := repo.GetByValue("nonexistent")
+	result, err := repo.GetByValue(context.Background(), "nonexistent")
 	if err == nil {
 		t.Errorf("Expected error, got nil")
 	}
@@ -60,7 +61,7 @@ func TestInsertAssignsIdWhenIdIsMinusOne(t *testing.T) {
 	repo := NewRepository()
 	url := &Url{Id: -1, Original: "https://example.com", Shortened: "abc"}
 
-	result, err := repo.Insert(url)
+	result, err := repo.Insert(context.Background(), url)
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
 	}
@@ -73,7 +74,7 @@ func TestInsertKeepsExistingIdWhenNotMinusOne(t *testing.T) {
 	repo := NewRepository()
 	url := &Url{Id: 5, Original: "https://example.com", Shortened: "abc"}
 
-	result, err := repo.Insert(url)
+	result, err := repo.Insert(context.Background(), url)
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
 	}
@@ -86,7 +87,7 @@ func TestInsertStoresUrlInRepository(t *testing.T) {
 	repo := NewRepository()
 	url := &Url{Id: 1, Original: "https://example.com", Shortened: "abc"}
 
-	insert, err := repo.Insert(url)
+	insert, err := repo.Insert(context.Background(), url)
 	if err != nil {
 		t.Errorf("Failed to insert record")
 	}
@@ -106,9 +107,9 @@ func TestUpdateModifiesExistingUrl(t *testing.T) {
 	original := &Url{Id: 1, Original: "https://example.com", Shortened: "abc"}
 	repo.urls[1] = original
 
-	err := repo.Update(original)
+	visits, err := repo.Update(context.Background(), original)
 
-	if err != nil {
+	if err != nil || visits != 1 {
 		t.Errorf("Expected no error, got %v", err)
 	}
 	if repo.urls[1].Visits != 1 {
@@ -120,7 +121,7 @@ func TestUpdateReturnsNilForNonExistentUrl(t *testing.T) {
 	repo := NewRepository()
 	url := &Url{Id: 999, Original: "https://example.com", Shortened: "abc"}
 
-	err := repo.Update(url)
+	_, err := repo.Update(context.Background(), url)
 	if err == nil {
 		t.Errorf("Expected error, got none")
 	}
@@ -131,7 +132,7 @@ func TestNextReturnsCurrentMapSize(t *testing.T) {
 	repo.urls[1] = &Url{Id: 1, Original: "https://example.com", Shortened: "abc"}
 	repo.urls[2] = &Url{Id: 2, Original: "https://test.com", Shortened: "def"}
 
-	result, err := repo.Next()
+	result, err := repo.Next(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
 	}
@@ -143,7 +144,7 @@ func TestNextReturnsCurrentMapSize(t *testing.T) {
 func TestNextReturnsZeroForEmptyRepository(t *testing.T) {
 	repo := NewRepository()
 
-	result, err := repo.Next()
+	result, err := repo.Next(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
 	}
@@ -162,3 +163,65 @@ func TestNewRepositoryCreatesEmptyRepository(t *testing.T) {
 		t.Errorf("Expected empty urls map, got %d items", len(repo.urls))
 	}
 }
+
+func TestListReturnsAllUrls(t *testing.T) {
+	repo := NewRepository()
+	repo.urls[1] = &Url{Id: 1, Original: "https://example.com", Shortened: "abc"}
+	repo.urls[2] = &Url{Id: 2, Original: "https://test.com", Shortened: "def"}
+
+	result, err := repo.List(context.Background())
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if len(result) != 2 {
+		t.Errorf("Expected 2 urls, got %d", len(result))
+	}
+}
+
+func TestModifyChangesOnlyTheModifiedFields(t *testing.T) {
+	repo := NewRepository()
+	original := &Url{Id: 1, Original: "https://example.com", Shortened: "abc"}
+	repo.urls[1] = original
+	_, _ = repo.Update(context.Background(), original)
+
+	modified, err := repo.Modify(context.Background(), 1, func(u *Url) { u.Liveness.LastStatus = 404 })
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if repo.urls[1] != modified || modified.Liveness.LastStatus != 404 {
+		t.Errorf("Expected the modified link to be stored, got %+v", repo.urls[1])
+	}
+	if modified.Visits != 1 {
+		t.Errorf("Expected the recorded visit to be kept, got %d", modified.Visits)
+	}
+	if original.Liveness.LastStatus != 0 {
+		t.Errorf("Expected the link handed out earlier to stay unchanged")
+	}
+}
+
+func TestModifyReturnsErrorForNonExistentUrl(t *testing.T) {
+	repo := NewRepository()
+
+	if _, err := repo.Modify(context.Background(), 1, func(*Url) {}); err == nil {
+		t.Errorf("Expected error, got nil")
+	}
+}
+
+func TestNextDoesNotReuseIdsOfDeletedUrls(t *testing.T) {
+	repo := NewRepository()
+	for i := 0; i < 3; i++ {
+		_, _ = repo.Insert(context.Background(), &Url{Id: i})
+	}
+
+	if err := repo.Delete(context.Background(), 2); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	next, _ := repo.Next(context.Background())
+
+	if next != 3 {
+		t.Errorf("Expected next id 3, got %d", next)
+	}
+	if deleted, _ := repo.GetById(context.Background(), 2); deleted != nil {
+		t.Errorf("Expected deleted url to be gone, got %v", deleted)
+	}
+}
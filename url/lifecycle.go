@@ -0,0 +1,141 @@
+package url
+
+import (
+	"context"
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"thesilentcoder.com/m/events"
+	"thesilentcoder.com/m/useragent"
+	"time"
+)
+
+const expiryCheckInterval = time.Minute
+
+func eventLink(u *Url) events.Link {
+	return events.Link{
+		Id:        u.Id,
+		Shortened: u.Shortened,
+		Url:       u.Url,
+		Original:  u.Original,
+		Owner:     u.Owner,
+		Tags:      u.Tags,
+		Campaign:  u.Campaign,
+		Visits:    u.Visits,
+	}
+}
+
+func (s Service) publish(ctx context.Context, event events.Event) {
+	if s.publisher != nil {
+		s.publisher.Publish(ctx, event)
+	}
+}
+
+func (s Service) expired(link *Url) bool {
+	return !link.ExpiresAt.IsZero() && !s.now().Before(link.ExpiresAt)
+}
+
+// publishVisit publishes a link.visited event for the visit just recorded,
+// and a link.visit_threshold event when it brought the link to one of the
+// configured thresholds. visits is the count Update returned for this visit,
+// so every threshold is published exactly once however visits interleave.
+func (s Service) publishVisit(r *http.Request, link *Url, visits int, t target, destination string) {
+	if s.publisher == nil {
+		return
+	}
+	visited := eventLink(link)
+	visited.Visits = visits
+	agent := useragent.Parse(r.UserAgent())
+	visit := events.New(events.LinkVisited, visited)
+	visit.Visit = &events.Visit{
+		Destination: destination,
+		Referrer:    referrerHost(r),
+		Country:     newVisitor(r, s.countryHeader).country,
+		Os:          agent.Os,
+		Device:      agent.Device,
+		Browser:     agent.Browser,
+		Rule:        t.rule,
+		Variant:     t.variant,
+	}
+	s.publish(r.Context(), visit)
+	if slices.Contains(s.visitThresholds, visits) {
+		event := events.New(events.LinkVisitThreshold, visited)
+		event.Threshold = visits
+		s.publish(r.Context(), event)
+	}
+}
+
+func referrerHost(r *http.Request) string {
+	referrer, err := url.Parse(r.Referer())
+	if err != nil {
+		return ""
+	}
+	return referrer.Hostname()
+}
+
+func (s Service) handleDeleteUrl(writer http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(writer, "Invalid ID format", http.StatusBadRequest)
+		return
+	}
+	link, err := s.repository.GetById(r.Context(), id)
+	if err != nil || link == nil || link.Owner != ownerFrom(r.Context()) {
+		http.Error(writer, "URL not found", http.StatusNotFound)
+		return
+	}
+	if err := s.repository.Delete(r.Context(), id); err != nil {
+		zerolog.Ctx(r.Context()).Error().Err(err).Int("id", id).Msg("Failed to delete url")
+		http.Error(writer, "Failed to delete URL", http.StatusInternalServerError)
+		return
+	}
+	s.publish(r.Context(), events.New(events.LinkDeleted, eventLink(link)))
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// WatchExpiry publishes a link.expired event for every link that passes its
+// expiry, until ctx is done. Expired links stop redirecting whether or not
+// this runs.
+func (s Service) WatchExpiry(ctx context.Context) {
+	if s.publisher == nil {
+		return
+	}
+	ticker := time.NewTicker(expiryCheckInterval)
+	defer ticker.Stop()
+	for {
+		s.publishExpired(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s Service) publishExpired(ctx context.Context) {
+	links, err := s.repository.List(ctx)
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("Failed to list urls for expiry")
+		return
+	}
+	for _, link := range links {
+		if link.ExpiryPublished || !s.expired(link) {
+			continue
+		}
+		published := false
+		updated, err := s.repository.Modify(ctx, link.Id, func(stored *Url) {
+			published = !stored.ExpiryPublished
+			stored.ExpiryPublished = true
+		})
+		if err != nil {
+			zerolog.Ctx(ctx).Error().Err(err).Int("id", link.Id).Msg("Failed to mark url as expired")
+			continue
+		}
+		if published {
+			s.publish(ctx, events.New(events.LinkExpired, eventLink(updated)))
+		}
+	}
+}
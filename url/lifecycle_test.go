@@ -0,0 +1,215 @@
+package url
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"thesilentcoder.com/m/events"
+	"time"
+)
+
+type recordingPublisher struct {
+	mu     sync.Mutex
+	events []events.Event
+}
+
+func (p *recordingPublisher) Publish(_ context.Context, event events.Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.events = append(p.events, event)
+}
+
+func (p *recordingPublisher) types() []string {
+	var result []string
+	for _, event := range p.events {
+		result = append(result, event.Type)
+	}
+	return result
+}
+
+func (p *recordingPublisher) ofType(eventType string) []events.Event {
+	var result []events.Event
+	for _, event := range p.events {
+		if event.Type == eventType {
+			result = append(result, event)
+		}
+	}
+	return result
+}
+
+func TestShortenPublishesLinkCreated(t *testing.T) {
+	publisher := &recordingPublisher{}
+	service := New(newMockRepository(), ":8080", "http://localhost", "api", 1, WithPublisher(publisher))
+
+	body, _ := json.Marshal(ShortLink{Url: "https://example.com", Tags: []string{"launch"}})
+	w := httptest.NewRecorder()
+	service.handleUrlShorten(w, httptest.NewRequest(http.MethodPost, "/api/v1/shorten", bytes.NewBuffer(body)))
+
+	if len(publisher.events) != 1 || publisher.events[0].Type != events.LinkCreated {
+		t.Fatalf("Expected a link.created event, got %v", publisher.types())
+	}
+	if link := publisher.events[0].Link; link.Shortened != "a" || link.Original != "https://example.com" || len(link.Tags) != 1 {
+		t.Errorf("Expected the event to carry the link, got %+v", link)
+	}
+}
+
+func TestDeleteUrlPublishesLinkDeleted(t *testing.T) {
+	repo := newMockRepository()
+	repo.urls[0] = &Url{Id: 0, Original: "https://example.com", Shortened: "a"}
+	publisher := &recordingPublisher{}
+	service := New(repo, ":8080", "http://localhost", "api", 1, WithPublisher(publisher))
+	router := mux.NewRouter()
+	service.RegisterHandlers(router)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/v1/urls/0", nil))
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", w.Code)
+	}
+	if _, exists := repo.urls[0]; exists {
+		t.Errorf("Expected the link to be deleted")
+	}
+	if types := publisher.types(); len(types) != 1 || types[0] != events.LinkDeleted {
+		t.Errorf("Expected a link.deleted event, got %v", types)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/v1/urls/0", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", w.Code)
+	}
+}
+
+func TestShortenRejectsPastExpiry(t *testing.T) {
+	service := New(newMockRepository(), ":8080", "http://localhost", "api", 1)
+
+	body, _ := json.Marshal(ShortLink{Url: "https://example.com", ExpiresAt: "2000-01-01T00:00:00Z"})
+	w := httptest.NewRecorder()
+	service.handleUrlShorten(w, httptest.NewRequest(http.MethodPost, "/api/v1/shorten", bytes.NewBuffer(body)))
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+}
+
+func TestExpiredLinksAreGone(t *testing.T) {
+	repo := newMockRepository()
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	repo.urls[0] = &Url{Id: 0, Original: "https://example.com", Shortened: "a", ExpiresAt: now}
+	service := New(repo, ":8080", "http://localhost", "api", 1)
+	service.now = func() time.Time { return now }
+	router := mux.NewRouter()
+	service.RegisterHandlers(router)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/a/", nil))
+	if w.Code != http.StatusGone {
+		t.Errorf("Expected status 410, got %d", w.Code)
+	}
+	if repo.urls[0].Visits != 0 {
+		t.Errorf("Expected no visit to be counted, got %d", repo.urls[0].Visits)
+	}
+}
+
+func TestPublishExpiredPublishesOnce(t *testing.T) {
+	repo := newMockRepository()
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	repo.urls[0] = &Url{Id: 0, Shortened: "a", ExpiresAt: now.Add(-time.Minute)}
+	repo.urls[1] = &Url{Id: 1, Shortened: "b", ExpiresAt: now.Add(time.Hour)}
+	repo.urls[2] = &Url{Id: 2, Shortened: "c"}
+	publisher := &recordingPublisher{}
+	service := New(repo, ":8080", "http://localhost", "api", 1, WithPublisher(publisher))
+	service.now = func() time.Time { return now }
+
+	service.publishExpired(context.Background())
+	service.publishExpired(context.Background())
+
+	if len(publisher.events) != 1 || publisher.events[0].Type != events.LinkExpired || publisher.events[0].Link.Id != 0 {
+		t.Errorf("Expected one link.expired event for link 0, got %v", publisher.events)
+	}
+	if !repo.urls[0].ExpiryPublished {
+		t.Errorf("Expected the link to be marked as published")
+	}
+}
+
+func TestVisitThresholdsArePublished(t *testing.T) {
+	repo := newMockRepository()
+	repo.urls[0] = &Url{Id: 0, Original: "https://example.com", Shortened: "a"}
+	publisher := &recordingPublisher{}
+	service := New(repo, ":8080", "http://localhost", "api", 1, WithPublisher(publisher), WithVisitThresholds([]int{2, 3, 0}))
+	router := mux.NewRouter()
+	service.RegisterHandlers(router)
+
+	for range 4 {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/a/", nil))
+	}
+
+	thresholds := publisher.ofType(events.LinkVisitThreshold)
+	if len(thresholds) != 2 {
+		t.Fatalf("Expected 2 threshold events, got %v", publisher.types())
+	}
+	for i, threshold := range []int{2, 3} {
+		if thresholds[i].Threshold != threshold {
+			t.Errorf("Expected link.visit_threshold at %d, got %d", threshold, thresholds[i].Threshold)
+		}
+	}
+}
+
+func TestRedirectPublishesLinkVisited(t *testing.T) {
+	repo := newMockRepository()
+	repo.urls[0] = &Url{Id: 0, Original: "https://example.com", Shortened: "a", Tags: []string{"launch"}}
+	publisher := &recordingPublisher{}
+	service := New(repo, ":8080", "http://localhost", "api", 1, WithPublisher(publisher), WithCountryHeader("CF-IPCountry"))
+	router := mux.NewRouter()
+	service.RegisterHandlers(router)
+
+	r := httptest.NewRequest(http.MethodGet, "/a/", nil)
+	r.Header.Set("Referer", "https://news.example.org/item?id=1")
+	r.Header.Set("CF-IPCountry", "nl")
+	router.ServeHTTP(httptest.NewRecorder(), r)
+
+	visits := publisher.ofType(events.LinkVisited)
+	if len(visits) != 1 {
+		t.Fatalf("Expected a link.visited event, got %v", publisher.types())
+	}
+	if visits[0].Link.Visits != 1 || visits[0].Visit == nil {
+		t.Fatalf("Expected the visit to be counted and described, got %+v", visits[0])
+	}
+	if visit := visits[0].Visit; visit.Destination != "https://example.com" || visit.Referrer != "news.example.org" || visit.Country != "NL" {
+		t.Errorf("Expected destination, referrer host and country, got %+v", visit)
+	}
+}
+
+func TestConcurrentVisitsPublishEveryThresholdOnce(t *testing.T) {
+	repo := NewRepository()
+	_, _ = repo.Insert(context.Background(), &Url{Id: 0, Original: "https://example.com", Shortened: "a"})
+	publisher := &recordingPublisher{}
+	service := New(repo, ":8080", "http://localhost", "api", 1, WithPublisher(publisher), WithVisitThresholds([]int{10, 20, 30}))
+	router := mux.NewRouter()
+	service.RegisterHandlers(router)
+
+	wg := sync.WaitGroup{}
+	for range 40 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/a/", nil))
+		}()
+	}
+	wg.Wait()
+
+	published := make(map[int]int)
+	for _, event := range publisher.ofType(events.LinkVisitThreshold) {
+		published[event.Threshold]++
+	}
+	for _, threshold := range []int{10, 20, 30} {
+		if published[threshold] != 1 {
+			t.Errorf("Expected threshold %d to be published once, got %d", threshold, published[threshold])
+		}
+	}
+}
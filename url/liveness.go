@@ -0,0 +1,205 @@
+package url
+
+import (
+	"context"
+	"fmt"
+	"github.com/rs/zerolog"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"thesilentcoder.com/m/fetch"
+	"thesilentcoder.com/m/repository"
+	"time"
+)
+
+const (
+	livenessScanInterval = time.Minute
+	maxLivenessBackoff   = 24 * time.Hour
+	maxProbeBody         = 64 << 10
+	livenessUserAgent    = "url-shortener-liveness/1.0"
+)
+
+// Liveness is the outcome of the latest probes of a link's destination.
+type Liveness struct {
+	// LastStatus is the HTTP status of the last probe, 0 when it failed
+	// before a response arrived.
+	LastStatus  int
+	LastError   string
+	LastChecked time.Time
+	// FailureStreak counts the probes that failed in a row.
+	FailureStreak int
+}
+
+func healthyStatus(status int) bool {
+	return status > 0 && status < http.StatusBadRequest
+}
+
+type LivenessConfig struct {
+	// Interval is how often each link is probed while it is healthy. Failing
+	// links are probed half as often with every further failure.
+	Interval time.Duration
+	// Concurrency caps the number of hosts probed at the same time.
+	Concurrency int
+	// HostDelay is the pause between two probes of the same host.
+	HostDelay time.Duration
+}
+
+// LivenessChecker probes link destinations in the background and records the
+// outcome on the links.
+type LivenessChecker struct {
+	repository repository.Repository[Url]
+	config     LivenessConfig
+	client     *fetch.Client
+	now        func() time.Time
+	sleep      func(context.Context, time.Duration)
+}
+
+// NewLivenessChecker returns a checker probing with client, or nil when
+// config.Interval is not positive. The client's address checks apply to every
+// redirect it follows.
+func NewLivenessChecker(repository repository.Repository[Url], client *fetch.Client, config LivenessConfig) *LivenessChecker {
+	if config.Interval <= 0 {
+		return nil
+	}
+	if config.Concurrency <= 0 {
+		config.Concurrency = 4
+	}
+	return &LivenessChecker{
+		repository: repository,
+		config:     config,
+		client:     client,
+		now:        time.Now,
+		sleep:      sleepContext,
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+// Run probes the links that are due every minute until ctx is done.
+func (c *LivenessChecker) Run(ctx context.Context) {
+	ticker := time.NewTicker(livenessScanInterval)
+	defer ticker.Stop()
+	for {
+		c.checkDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// due reports whether link should be probed again, backing off exponentially
+// while its destination keeps failing.
+func (c *LivenessChecker) due(link *Url, now time.Time) bool {
+	if link.Liveness.LastChecked.IsZero() {
+		return true
+	}
+	wait := c.config.Interval
+	for i := 0; i < link.Liveness.FailureStreak && wait < maxLivenessBackoff; i++ {
+		wait *= 2
+	}
+	return !now.Before(link.Liveness.LastChecked.Add(min(wait, maxLivenessBackoff)))
+}
+
+// checkDue probes every link that is due. Links are grouped by host: each
+// host is probed by a single worker, pausing between probes, and at most
+// Concurrency hosts are probed at once.
+func (c *LivenessChecker) checkDue(ctx context.Context) {
+	links, err := c.repository.List(ctx)
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("Failed to list links for liveness checks")
+		return
+	}
+	now := c.now()
+	byHost := make(map[string][]*Url)
+	for _, link := range links {
+		if !c.due(link, now) {
+			continue
+		}
+		parsed, err := url.Parse(link.Original)
+		if err != nil {
+			continue
+		}
+		byHost[parsed.Host] = append(byHost[parsed.Host], link)
+	}
+
+	slots := make(chan struct{}, c.config.Concurrency)
+	wg := sync.WaitGroup{}
+	for _, hostLinks := range byHost {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-slots }()
+			for i, link := range hostLinks {
+				if i > 0 {
+					c.sleep(ctx, c.config.HostDelay)
+				}
+				if ctx.Err() != nil {
+					return
+				}
+				c.check(ctx, link)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func (c *LivenessChecker) check(ctx context.Context, link *Url) {
+	status, probeErr := c.probe(ctx, link.Original)
+	checked := c.now().UTC()
+	_, err := c.repository.Modify(ctx, link.Id, func(stored *Url) {
+		stored.Liveness.LastStatus = status
+		stored.Liveness.LastChecked = checked
+		stored.Liveness.LastError = ""
+		if probeErr != nil {
+			stored.Liveness.LastError = probeErr.Error()
+		}
+		if healthyStatus(status) {
+			stored.Liveness.FailureStreak = 0
+		} else {
+			stored.Liveness.FailureStreak++
+		}
+	})
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Str("short_code", link.Shortened).Msg("Failed to record liveness")
+	}
+}
+
+// probe sends a HEAD request, falling back to GET for servers that do not
+// answer HEAD properly.
+func (c *LivenessChecker) probe(ctx context.Context, destination string) (int, error) {
+	status, err := c.request(ctx, http.MethodHead, destination)
+	if err == nil && status != http.StatusMethodNotAllowed && status != http.StatusNotImplemented && status != http.StatusForbidden {
+		return status, nil
+	}
+	return c.request(ctx, http.MethodGet, destination)
+}
+
+func (c *LivenessChecker) request(ctx context.Context, method string, destination string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, destination, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", livenessUserAgent)
+	response, err := c.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("%s %s: %w", method, destination, err)
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, maxProbeBody))
+	return response.StatusCode, nil
+}
@@ -0,0 +1,132 @@
+package url
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"thesilentcoder.com/m/fetch"
+	"time"
+)
+
+func newLivenessChecker(repo *mockRepository, now time.Time) *LivenessChecker {
+	checker := NewLivenessChecker(repo, fetch.New(fetch.Config{AllowPrivateNetworks: true}), LivenessConfig{Interval: time.Hour, Concurrency: 2})
+	checker.now = func() time.Time { return now }
+	return checker
+}
+
+func TestCheckDueRecordsStatusAndFailureStreak(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/gone" {
+			writer.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	repo := newMockRepository()
+	repo.urls[0] = &Url{Id: 0, Original: server.URL + "/ok", Shortened: "a", Liveness: Liveness{FailureStreak: 2}}
+	repo.urls[1] = &Url{Id: 1, Original: server.URL + "/gone", Shortened: "b", Liveness: Liveness{FailureStreak: 2}}
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	newLivenessChecker(repo, now).checkDue(context.Background())
+
+	if ok := repo.urls[0].Liveness; ok.LastStatus != http.StatusOK || ok.FailureStreak != 0 || !ok.LastChecked.Equal(now) {
+		t.Errorf("Expected healthy link to reset its streak, got %+v", ok)
+	}
+	if gone := repo.urls[1].Liveness; gone.LastStatus != http.StatusNotFound || gone.FailureStreak != 3 {
+		t.Errorf("Expected broken link to extend its streak, got %+v", gone)
+	}
+}
+
+func TestProbeFallsBackToGet(t *testing.T) {
+	var gets atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			writer.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		gets.Add(1)
+	}))
+	defer server.Close()
+	checker := newLivenessChecker(newMockRepository(), time.Now())
+
+	status, err := checker.probe(context.Background(), server.URL)
+
+	if err != nil || status != http.StatusOK || gets.Load() != 1 {
+		t.Errorf("Expected GET fallback to answer 200, got %d %v after %d GETs", status, err, gets.Load())
+	}
+}
+
+func TestProbeRefusesPrivateNetworks(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		requests.Add(1)
+	}))
+	defer server.Close()
+	checker := NewLivenessChecker(newMockRepository(), fetch.New(fetch.Config{}), LivenessConfig{Interval: time.Hour})
+
+	_, err := checker.probe(context.Background(), server.URL)
+
+	if !errors.Is(err, fetch.ErrPrivateNetwork) || requests.Load() != 0 {
+		t.Errorf("Expected the loopback destination to be refused, got %v after %d requests", err, requests.Load())
+	}
+}
+
+func TestDueBacksOffWhileFailing(t *testing.T) {
+	checker := newLivenessChecker(newMockRepository(), time.Now())
+	checked := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	failing := &Url{Liveness: Liveness{LastChecked: checked, FailureStreak: 2}}
+
+	if checker.due(failing, checked.Add(3*time.Hour)) {
+		t.Errorf("Expected link failing twice to wait four intervals")
+	}
+	if !checker.due(failing, checked.Add(4*time.Hour)) {
+		t.Errorf("Expected link to be due after four intervals")
+	}
+	if !checker.due(&Url{}, checked) {
+		t.Errorf("Expected unchecked link to be due")
+	}
+}
+
+func TestCheckDueSpacesProbesOfTheSameHost(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer server.Close()
+	repo := newMockRepository()
+	for i := 0; i < 3; i++ {
+		repo.urls[i] = &Url{Id: i, Original: server.URL, Shortened: string(rune('a' + i))}
+	}
+	checker := newLivenessChecker(repo, time.Now())
+	checker.config.HostDelay = time.Second
+	var pauses []time.Duration
+	checker.sleep = func(_ context.Context, d time.Duration) { pauses = append(pauses, d) }
+
+	checker.checkDue(context.Background())
+
+	if len(pauses) != 2 {
+		t.Errorf("Expected 2 pauses between 3 probes of one host, got %v", pauses)
+	}
+}
+
+func TestNewLivenessCheckerDisabledWithoutInterval(t *testing.T) {
+	if checker := NewLivenessChecker(newMockRepository(), fetch.New(fetch.Config{}), LivenessConfig{}); checker != nil {
+		t.Errorf("Expected no checker without an interval")
+	}
+}
+
+func TestCheckKeepsChangesMadeDuringTheProbe(t *testing.T) {
+	repo := NewRepository()
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		_, _ = repo.Modify(context.Background(), 0, func(u *Url) { u.Metadata.Title = "Fetched meanwhile" })
+	}))
+	defer server.Close()
+	_, _ = repo.Insert(context.Background(), &Url{Id: 0, Original: server.URL, Shortened: "a"})
+	checker := NewLivenessChecker(repo, fetch.New(fetch.Config{AllowPrivateNetworks: true}), LivenessConfig{Interval: time.Hour})
+
+	checker.checkDue(context.Background())
+
+	link, _ := repo.GetById(context.Background(), 0)
+	if link.Metadata.Title != "Fetched meanwhile" || link.Liveness.LastStatus != http.StatusOK {
+		t.Errorf("Expected both the metadata and the probe to be recorded, got %+v %+v", link.Metadata, link.Liveness)
+	}
+}
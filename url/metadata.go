@@ -0,0 +1,246 @@
+package url
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"golang.org/x/net/html"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"thesilentcoder.com/m/fetch"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	maxDescriptionLength = 1024
+	maxMetadataFetches   = 4
+)
+
+// Metadata is what the destination page says about itself, fetched after the
+// link is created.
+type Metadata struct {
+	Title       string    `json:"title,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Favicon     string    `json:"favicon,omitempty"`
+	Image       string    `json:"image,omitempty"`
+	FetchedAt   time.Time `json:"fetched_at"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// metadataFetcher fetches destination pages, at most maxMetadataFetches at a
+// time.
+type metadataFetcher struct {
+	client *fetch.Client
+	slots  chan struct{}
+}
+
+func newMetadataFetcher(client *fetch.Client) *metadataFetcher {
+	if client == nil {
+		return nil
+	}
+	return &metadataFetcher{client: client, slots: make(chan struct{}, maxMetadataFetches)}
+}
+
+func (f *metadataFetcher) fetch(ctx context.Context, destination string) Metadata {
+	select {
+	case f.slots <- struct{}{}:
+	case <-ctx.Done():
+		return Metadata{Error: ctx.Err().Error()}
+	}
+	defer func() { <-f.slots }()
+
+	page, err := f.client.Get(ctx, destination)
+	if err != nil {
+		return Metadata{Error: err.Error()}
+	}
+	if page.Status >= http.StatusBadRequest {
+		return Metadata{Error: fmt.Sprintf("destination answered %d", page.Status)}
+	}
+	if !isHtml(page.ContentType) {
+		return Metadata{Error: fmt.Sprintf("destination is %s, not HTML", page.ContentType)}
+	}
+	base, err := url.Parse(page.Url)
+	if err != nil {
+		return Metadata{Error: err.Error()}
+	}
+	return parseMetadata(base, page.Body)
+}
+
+func isHtml(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
+
+// parseMetadata reads the head of an HTML page. Open Graph values stand in
+// for a missing title or description, and the favicon defaults to
+// /favicon.ico on the page's host.
+func parseMetadata(base *url.URL, body []byte) Metadata {
+	var metadata Metadata
+	var ogTitle, ogDescription string
+	tokenizer := html.NewTokenizer(bytes.NewReader(body))
+	inTitle := false
+	for done := false; !done; {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			done = true
+		case html.TextToken:
+			if inTitle && metadata.Title == "" {
+				metadata.Title = strings.TrimSpace(string(tokenizer.Text()))
+			}
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			switch string(name) {
+			case "title":
+				inTitle = false
+			case "head":
+				done = true
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, _ := tokenizer.TagName()
+			attributes := tagAttributes(tokenizer)
+			switch string(name) {
+			case "title":
+				inTitle = true
+			case "body":
+				done = true
+			case "meta":
+				content := strings.TrimSpace(attributes["content"])
+				switch {
+				case strings.EqualFold(attributes["name"], "description"):
+					metadata.Description = content
+				case attributes["property"] == "og:title":
+					ogTitle = content
+				case attributes["property"] == "og:description":
+					ogDescription = content
+				case attributes["property"] == "og:image" && metadata.Image == "":
+					metadata.Image = resolveReference(base, content)
+				}
+			case "link":
+				if metadata.Favicon == "" && isIconRel(attributes["rel"]) {
+					metadata.Favicon = resolveReference(base, attributes["href"])
+				}
+			}
+		}
+	}
+
+	if metadata.Title == "" {
+		metadata.Title = ogTitle
+	}
+	if metadata.Description == "" {
+		metadata.Description = ogDescription
+	}
+	if metadata.Favicon == "" {
+		metadata.Favicon = resolveReference(base, "/favicon.ico")
+	}
+	metadata.Title = truncate(metadata.Title, maxTitleLength)
+	metadata.Description = truncate(metadata.Description, maxDescriptionLength)
+	return metadata
+}
+
+func tagAttributes(tokenizer *html.Tokenizer) map[string]string {
+	attributes := make(map[string]string)
+	for {
+		key, value, more := tokenizer.TagAttr()
+		attributes[strings.ToLower(string(key))] = string(value)
+		if !more {
+			return attributes
+		}
+	}
+}
+
+func isIconRel(rel string) bool {
+	for _, value := range strings.Fields(strings.ToLower(rel)) {
+		if value == "icon" {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveReference resolves reference against base, keeping only http and
+// https results.
+func resolveReference(base *url.URL, reference string) string {
+	parsed, err := url.Parse(strings.TrimSpace(reference))
+	if err != nil || reference == "" {
+		return ""
+	}
+	resolved := base.ResolveReference(parsed)
+	if resolved.Scheme != "http" && resolved.Scheme != "https" {
+		return ""
+	}
+	return resolved.String()
+}
+
+// truncate cuts value to at most limit bytes without splitting a character.
+func truncate(value string, limit int) string {
+	if len(value) <= limit {
+		return value
+	}
+	for limit > 0 && !utf8.RuneStart(value[limit]) {
+		limit--
+	}
+	return value[:limit]
+}
+
+// refreshMetadata fetches the metadata of the link with the given id and
+// stores it on the link.
+func (s Service) refreshMetadata(ctx context.Context, id int) (*Url, error) {
+	link, err := s.repository.GetById(ctx, id)
+	if err != nil || link == nil {
+		return nil, fmt.Errorf("url with id %d not found", id)
+	}
+	metadata := s.metadata.fetch(ctx, link.Original)
+	metadata.FetchedAt = s.now().UTC()
+
+	return s.repository.Modify(ctx, id, func(stored *Url) {
+		stored.Metadata = metadata
+	})
+}
+
+// fetchMetadataLater fetches a new link's metadata in the background, so
+// that shortening does not wait for the destination.
+func (s Service) fetchMetadataLater(ctx context.Context, id int) {
+	if s.metadata == nil {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		if _, err := s.refreshMetadata(ctx, id); err != nil {
+			zerolog.Ctx(ctx).Error().Err(err).Int("id", id).Msg("Failed to store link metadata")
+		}
+	}()
+}
+
+func (s Service) handleRefreshMetadata(writer http.ResponseWriter, r *http.Request) {
+	if s.metadata == nil {
+		http.Error(writer, "Metadata fetching is disabled", http.StatusNotImplemented)
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(writer, "Invalid ID format", http.StatusBadRequest)
+		return
+	}
+	link, err := s.repository.GetById(r.Context(), id)
+	if err != nil || link == nil || link.Owner != ownerFrom(r.Context()) {
+		http.Error(writer, "URL not found", http.StatusNotFound)
+		return
+	}
+
+	link, err = s.refreshMetadata(r.Context(), id)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(writer).Encode(newLinkResponse(link)); err != nil {
+		http.Error(writer, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,132 @@
+package url
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"thesilentcoder.com/m/fetch"
+	"time"
+)
+
+const metadataPage = `<!DOCTYPE html>
+<html><head>
+<title> Example &amp; Co </title>
+<meta property="og:description" content="Open Graph description">
+<meta property="og:image" content="/images/card.png">
+<link rel="shortcut icon" href="static/icon.png">
+</head><body><title>Not this one</title></body></html>`
+
+func newMetadataServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/moved" {
+			http.Redirect(writer, r, "/docs/page", http.StatusFound)
+			return
+		}
+		writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = writer.Write([]byte(metadataPage))
+	}))
+}
+
+func TestParseMetadataReadsHead(t *testing.T) {
+	base, _ := url.Parse("https://example.com/docs/page")
+
+	metadata := parseMetadata(base, []byte(metadataPage))
+
+	if metadata.Title != "Example & Co" {
+		t.Errorf("Expected title 'Example & Co', got %q", metadata.Title)
+	}
+	if metadata.Description != "Open Graph description" {
+		t.Errorf("Expected Open Graph description, got %q", metadata.Description)
+	}
+	if metadata.Image != "https://example.com/images/card.png" {
+		t.Errorf("Expected resolved image, got %q", metadata.Image)
+	}
+	if metadata.Favicon != "https://example.com/docs/static/icon.png" {
+		t.Errorf("Expected resolved favicon, got %q", metadata.Favicon)
+	}
+}
+
+func TestParseMetadataDefaultsFavicon(t *testing.T) {
+	base, _ := url.Parse("https://example.com/a/b")
+
+	metadata := parseMetadata(base, []byte(`<html><head><meta name="description" content="Plain"><link rel="icon" href="javascript:alert(1)"></head></html>`))
+
+	if metadata.Description != "Plain" {
+		t.Errorf("Expected description 'Plain', got %q", metadata.Description)
+	}
+	if metadata.Favicon != "https://example.com/favicon.ico" {
+		t.Errorf("Expected default favicon, got %q", metadata.Favicon)
+	}
+}
+
+func TestTruncateKeepsCharactersWhole(t *testing.T) {
+	if result := truncate("héllo", 2); result != "h" {
+		t.Errorf("Expected 'h', got %q", result)
+	}
+}
+
+func TestHandleUrlShortenFetchesMetadataInBackground(t *testing.T) {
+	server := newMetadataServer()
+	defer server.Close()
+	repo := NewRepository()
+	service := New(repo, ":8080", "http://localhost", "api", 1, WithMetadataFetching(fetch.New(fetch.Config{AllowPrivateNetworks: true})))
+
+	w := httptest.NewRecorder()
+	service.handleUrlShorten(w, newShortenRequest(t, ShortLink{Url: server.URL + "/moved"}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		link, _ := repo.GetById(context.Background(), 0)
+		if !link.Metadata.FetchedAt.IsZero() {
+			if link.Metadata.Title != "Example & Co" || link.Metadata.Image != server.URL+"/images/card.png" {
+				t.Errorf("Expected metadata of the redirected page, got %+v", link.Metadata)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected metadata to be fetched")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHandleRefreshMetadataRecordsErrors(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	repo := newMockRepository()
+	repo.urls[0] = &Url{Id: 0, Original: server.URL, Shortened: "a"}
+	service := New(repo, ":8080", "http://localhost", "api", 1, WithMetadataFetching(fetch.New(fetch.Config{AllowPrivateNetworks: true})))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/urls/0/metadata", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "0"})
+	w := httptest.NewRecorder()
+	service.handleRefreshMetadata(w, req)
+
+	var response LinkResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Metadata == nil || !strings.Contains(response.Metadata.Error, "404") {
+		t.Errorf("Expected fetch error in metadata, got %+v", response.Metadata)
+	}
+}
+
+func TestHandleRefreshMetadataDisabledWithoutFetcher(t *testing.T) {
+	service := New(newMockRepository(), ":8080", "http://localhost", "api", 1)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/urls/0/metadata", nil)
+	w := httptest.NewRecorder()
+	service.handleRefreshMetadata(w, req)
+
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("Expected status 501, got %d", w.Code)
+	}
+}
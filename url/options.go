@@ -0,0 +1,140 @@
+package url
+
+import (
+	"net"
+	"slices"
+	"strings"
+	"thesilentcoder.com/m/auth"
+	"thesilentcoder.com/m/domainpolicy"
+	"thesilentcoder.com/m/events"
+	"thesilentcoder.com/m/fetch"
+	"time"
+)
+
+type Option func(*Service)
+
+// WithAuthenticator protects the management API with API keys. Without it the
+// API is open to anyone who can reach the server.
+func WithAuthenticator(authenticator *auth.Authenticator) Option {
+	return func(s *Service) {
+		s.authenticator = authenticator
+	}
+}
+
+// WithPasswordCookies sets the key used to sign the cookies that remember
+// visitors who entered a link's password, and how long they stay valid.
+// Without it a random key is used, so cookies do not survive a restart.
+func WithPasswordCookies(secret []byte, ttl time.Duration) Option {
+	return func(s *Service) {
+		if len(secret) > 0 {
+			s.passwords.secret = secret
+		}
+		if ttl > 0 {
+			s.passwords.ttl = ttl
+		}
+	}
+}
+
+// WithTrustedProxies lets the client address be taken from X-Forwarded-For
+// when the request comes through one of the given proxies.
+func WithTrustedProxies(trustedProxies []*net.IPNet) Option {
+	return func(s *Service) {
+		s.passwords.trustedProxies = trustedProxies
+	}
+}
+
+// WithCountryHeader names the request header, set by a CDN or load balancer,
+// that carries the visitor's ISO country code for targeting rules.
+func WithCountryHeader(header string) Option {
+	return func(s *Service) {
+		s.countryHeader = header
+	}
+}
+
+// WithLocation sets the time zone that schedule times without an offset are
+// read in and that the "not yet available" page shows times in.
+func WithLocation(location *time.Location) Option {
+	return func(s *Service) {
+		if location != nil {
+			s.location = location
+		}
+	}
+}
+
+// WithDomainPolicy refuses links to, and redirects to, destinations whose
+// domain the policy does not accept.
+func WithDomainPolicy(policy *domainpolicy.Policy) Option {
+	return func(s *Service) {
+		s.domains = policy
+	}
+}
+
+// WithAllowedSchemes replaces the URL schemes destinations may use, http and
+// https by default.
+func WithAllowedSchemes(schemes []string) Option {
+	return func(s *Service) {
+		var allowed []string
+		for _, scheme := range schemes {
+			if scheme = strings.ToLower(strings.TrimSpace(scheme)); scheme != "" {
+				allowed = append(allowed, scheme)
+			}
+		}
+		if len(allowed) > 0 {
+			s.schemes = allowed
+		}
+	}
+}
+
+// WithFailoverThreshold sets how many liveness probes in a row have to fail
+// before visits go to a link's fallback destination, 3 by default.
+func WithFailoverThreshold(threshold int) Option {
+	return func(s *Service) {
+		if threshold > 0 {
+			s.failoverThreshold = threshold
+		}
+	}
+}
+
+// WithMetadataFetching fetches the title, description, favicon and Open Graph
+// image of destinations with client after links are created. Without it no
+// metadata is fetched.
+func WithMetadataFetching(client *fetch.Client) Option {
+	return func(s *Service) {
+		s.metadata = newMetadataFetcher(client)
+	}
+}
+
+// WithRedirectResolution lets links be created with resolve_redirects, which
+// follows the destination's redirect chain with client and links to where it
+// ends.
+func WithRedirectResolution(client *fetch.Client) Option {
+	return func(s *Service) {
+		s.resolver = client
+	}
+}
+
+// WithArchiver lets links be created with archive and archive_when_dead, and
+// serves their snapshots at /{code}/archive.
+func WithArchiver(archiver *Archiver) Option {
+	return func(s *Service) {
+		s.archiver = archiver
+	}
+}
+
+// WithPublisher publishes the link lifecycle events and a link.visited event
+// for every redirect to publisher.
+func WithPublisher(publisher events.Publisher) Option {
+	return func(s *Service) {
+		s.publisher = publisher
+	}
+}
+
+// WithVisitThresholds publishes a link.visit_threshold event when a link
+// reaches one of the given visit counts.
+func WithVisitThresholds(thresholds []int) Option {
+	return func(s *Service) {
+		s.visitThresholds = slices.DeleteFunc(slices.Clone(thresholds), func(threshold int) bool {
+			return threshold <= 0
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package url
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const (
+	QueryMergeLink    = "link"
+	QueryMergeRequest = "request"
+	QueryMergeAppend  = "append"
+)
+
+// Passthrough controls what a visitor appended to the short link is carried
+// over to the destination.
+type Passthrough struct {
+	// Query forwards the incoming query string.
+	Query bool `json:"forward_query,omitempty"`
+	// QueryMerge decides who wins when a parameter is set on both sides:
+	// the link (default), the request, or neither (append keeps both).
+	QueryMerge string `json:"query_merge,omitempty"`
+	// Path appends trailing path segments, so /{code}/docs/x goes to
+	// Original/docs/x.
+	Path bool `json:"forward_path,omitempty"`
+}
+
+func (p Passthrough) validate() error {
+	switch p.QueryMerge {
+	case "", QueryMergeLink, QueryMergeRequest, QueryMergeAppend:
+		return nil
+	}
+	return fmt.Errorf("query_merge must be %s, %s or %s", QueryMergeLink, QueryMergeRequest, QueryMergeAppend)
+}
+
+// Apply carries the incoming path suffix and raw query over to destination as
+// configured.
+func (p Passthrough) Apply(destination string, path string, rawQuery string) (string, error) {
+	if (!p.Path || path == "") && (!p.Query || rawQuery == "") {
+		return destination, nil
+	}
+	parsed, err := url.Parse(destination)
+	if err != nil {
+		return "", err
+	}
+	if p.Path && path != "" {
+		parsed = parsed.JoinPath(path)
+	}
+	if p.Query && rawQuery != "" {
+		parsed.RawQuery = mergeQuery(parsed.RawQuery, rawQuery, p.QueryMerge)
+	}
+	return parsed.String(), nil
+}
+
+// mergeQuery merges raw query strings pair by pair so that neither side gets
+// re-encoded or reordered.
+func mergeQuery(destination string, incoming string, merge string) string {
+	destinationPairs, incomingPairs := splitQuery(destination), splitQuery(incoming)
+	var pairs []string
+	switch merge {
+	case QueryMergeAppend:
+		pairs = append(destinationPairs, incomingPairs...)
+	case QueryMergeRequest:
+		overridden := queryKeys(incomingPairs)
+		for _, pair := range destinationPairs {
+			if !overridden[queryKey(pair)] {
+				pairs = append(pairs, pair)
+			}
+		}
+		pairs = append(pairs, incomingPairs...)
+	default:
+		pairs = destinationPairs
+		kept := queryKeys(destinationPairs)
+		for _, pair := range incomingPairs {
+			if !kept[queryKey(pair)] {
+				pairs = append(pairs, pair)
+			}
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+func splitQuery(rawQuery string) []string {
+	var pairs []string
+	for _, pair := range strings.Split(rawQuery, "&") {
+		if pair != "" {
+			pairs = append(pairs, pair)
+		}
+	}
+	return pairs
+}
+
+func queryKey(pair string) string {
+	key, _, _ := strings.Cut(pair, "=")
+	if unescaped, err := url.QueryUnescape(key); err == nil {
+		return unescaped
+	}
+	return key
+}
+
+func queryKeys(pairs []string) map[string]bool {
+	keys := make(map[string]bool, len(pairs))
+	for _, pair := range pairs {
+		keys[queryKey(pair)] = true
+	}
+	return keys
+}
@@ -0,0 +1,88 @@
+package url
+
+import (
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPassthroughApplyIgnoresRequestWhenDisabled(t *testing.T) {
+	result, err := Passthrough{}.Apply("https://example.com/base", "docs/x", "a=1")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if result != "https://example.com/base" {
+		t.Errorf("Expected destination unchanged, got %s", result)
+	}
+}
+
+func TestPassthroughApplyAppendsPath(t *testing.T) {
+	result, err := Passthrough{Path: true}.Apply("https://example.com/base/?a=1#top", "docs/x", "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if result != "https://example.com/base/docs/x?a=1#top" {
+		t.Errorf("Expected path to be appended, got %s", result)
+	}
+}
+
+func TestPassthroughApplyMergesQuery(t *testing.T) {
+	cases := []struct {
+		merge    string
+		expected string
+	}{
+		{"", "https://example.com/?a=1&b=2&c=3"},
+		{QueryMergeLink, "https://example.com/?a=1&b=2&c=3"},
+		{QueryMergeRequest, "https://example.com/?b=2&a=9&c=3"},
+		{QueryMergeAppend, "https://example.com/?a=1&b=2&a=9&c=3"},
+	}
+	for _, c := range cases {
+		result, err := Passthrough{Query: true, QueryMerge: c.merge}.Apply("https://example.com/?a=1&b=2", "", "a=9&c=3")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if result != c.expected {
+			t.Errorf("Expected %s for merge %q, got %s", c.expected, c.merge, result)
+		}
+	}
+}
+
+func TestPassthroughValidateRejectsUnknownMerge(t *testing.T) {
+	if err := (Passthrough{QueryMerge: "sometimes"}).validate(); err == nil {
+		t.Errorf("Expected error for unknown merge rule, got nil")
+	}
+}
+
+func TestRegisterHandlersForwardsPathAndQuery(t *testing.T) {
+	repo := newMockRepository()
+	repo.urls[0] = &Url{Id: 0, Original: "https://example.com/base", Shortened: "abc", Passthrough: Passthrough{Query: true, Path: true}}
+	router := mux.NewRouter()
+	New(repo, ":8080", "http://localhost", "api", 1).RegisterHandlers(router)
+
+	req := httptest.NewRequest(http.MethodGet, "/abc/docs/x?ref=mail", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusFound {
+		t.Fatalf("Expected status 302, got %d", w.Code)
+	}
+	if location := w.Header().Get("Location"); location != "https://example.com/base/docs/x?ref=mail" {
+		t.Errorf("Expected forwarded destination, got %s", location)
+	}
+	if repo.urls[0].Visits != 1 {
+		t.Errorf("Expected visit to be recorded, got %d", repo.urls[0].Visits)
+	}
+}
+
+func TestHandleUrlShortenRejectsInvalidQueryMerge(t *testing.T) {
+	service := New(newMockRepository(), ":8080", "http://localhost", "api", 1)
+
+	short := ShortLink{Url: "https://example.com", Passthrough: Passthrough{Query: true, QueryMerge: "sometimes"}}
+	w := httptest.NewRecorder()
+	service.handleUrlShorten(w, newShortenRequest(t, short))
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+}
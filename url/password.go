@@ -0,0 +1,166 @@
+package url
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"thesilentcoder.com/m/middleware"
+	"time"
+)
+
+const (
+	defaultUnlockTtl    = time.Hour
+	maxPasswordLength   = 72
+	maxPasswordFailures = 5
+	failureWindow       = 15 * time.Minute
+	unlockCookiePrefix  = "unlock_"
+)
+
+type passwordPage struct {
+	Action string
+	Error  string
+}
+
+// passwordGuard verifies passwords for protected links, throttles repeated
+// failures per client and link, and remembers successful visitors with a
+// signed cookie.
+type passwordGuard struct {
+	mu             sync.Mutex
+	secret         []byte
+	ttl            time.Duration
+	trustedProxies []*net.IPNet
+	failures       map[string]*failureCount
+	sweptAt        time.Time
+	now            func() time.Time
+}
+
+type failureCount struct {
+	count int
+	since time.Time
+}
+
+func newPasswordGuard() *passwordGuard {
+	secret := make([]byte, 32)
+	_, _ = rand.Read(secret)
+	return &passwordGuard{
+		secret:   secret,
+		ttl:      defaultUnlockTtl,
+		failures: make(map[string]*failureCount),
+		now:      time.Now,
+	}
+}
+
+func hashPassword(password string) (string, error) {
+	if len(password) > maxPasswordLength {
+		return "", fmt.Errorf("password must be at most %d bytes", maxPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// signature binds the cookie to the link, its current password hash and the
+// expiry, so changing the password invalidates earlier cookies.
+func (g *passwordGuard) signature(link *Url, expires int64) string {
+	mac := hmac.New(sha256.New, g.secret)
+	_, _ = fmt.Fprintf(mac, "%s|%s|%d", link.Shortened, link.PasswordHash, expires)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (g *passwordGuard) unlocked(r *http.Request, link *Url) bool {
+	cookie, err := r.Cookie(unlockCookiePrefix + link.Shortened)
+	if err != nil {
+		return false
+	}
+	expiresValue, signature, found := strings.Cut(cookie.Value, ".")
+	expires, err := strconv.ParseInt(expiresValue, 10, 64)
+	if !found || err != nil || g.now().Unix() > expires {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(g.signature(link, expires)))
+}
+
+func (g *passwordGuard) unlock(writer http.ResponseWriter, r *http.Request, link *Url) {
+	expires := g.now().Add(g.ttl).Unix()
+	http.SetCookie(writer, &http.Cookie{
+		Name:     unlockCookiePrefix + link.Shortened,
+		Value:    fmt.Sprintf("%d.%s", expires, g.signature(link, expires)),
+		Path:     "/",
+		MaxAge:   int(g.ttl.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// attempt counts a password attempt of the client before it is checked, so
+// that parallel guesses cannot all get in ahead of the lockout. It returns how
+// long the client has to wait instead when it has used up its attempts.
+func (g *passwordGuard) attempt(key string) time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := g.now()
+	if now.Sub(g.sweptAt) > failureWindow {
+		g.sweptAt = now
+		for k, failures := range g.failures {
+			if now.Sub(failures.since) > failureWindow {
+				delete(g.failures, k)
+			}
+		}
+	}
+	failures, exists := g.failures[key]
+	if !exists || now.Sub(failures.since) > failureWindow {
+		failures = &failureCount{since: now}
+		g.failures[key] = failures
+	}
+	if failures.count >= maxPasswordFailures {
+		return failureWindow - now.Sub(failures.since)
+	}
+	failures.count++
+	return 0
+}
+
+func (g *passwordGuard) reset(key string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.failures, key)
+}
+
+// challenge renders the password form, or checks a submitted password and on
+// success sends the visitor back to the link with an unlock cookie.
+func (s Service) challenge(writer http.ResponseWriter, r *http.Request, link *Url) {
+	page := passwordPage{Action: r.URL.RequestURI()}
+	if r.Method != http.MethodPost {
+		s.renderPage(writer, r, "password.html", http.StatusOK, page)
+		return
+	}
+
+	key := link.Shortened + "|" + middleware.ClientIP(r, s.passwords.trustedProxies)
+	if wait := s.passwords.attempt(key); wait > 0 {
+		writer.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		page.Error = "Too many attempts, try again later."
+		s.renderPage(writer, r, "password.html", http.StatusTooManyRequests, page)
+		return
+	}
+
+	password := r.PostFormValue("password")
+	if bcrypt.CompareHashAndPassword([]byte(link.PasswordHash), []byte(password)) != nil {
+		page.Error = "Incorrect password."
+		s.renderPage(writer, r, "password.html", http.StatusUnauthorized, page)
+		return
+	}
+
+	s.passwords.reset(key)
+	s.passwords.unlock(writer, r, link)
+	http.Redirect(writer, r, r.URL.RequestURI(), http.StatusSeeOther)
+}
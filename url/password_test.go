@@ -0,0 +1,170 @@
+package url
+
+import (
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newProtectedRouter(t *testing.T) (*mux.Router, *mockRepository, *Service) {
+	hash, err := hashPassword("open sesame")
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+	repo := newMockRepository()
+	repo.urls[0] = &Url{Id: 0, Original: "https://example.com/secret", Shortened: "abc", PasswordHash: hash}
+	service := New(repo, ":8080", "http://localhost", "api", 1, WithPasswordCookies([]byte("test-secret"), time.Minute))
+	router := mux.NewRouter()
+	service.RegisterHandlers(router)
+	return router, repo, service
+}
+
+func submitPassword(router *mux.Router, target string, password string) *httptest.ResponseRecorder {
+	form := url.Values{"password": {password}}
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestProtectedLinkShowsFormWithoutRevealingDestination(t *testing.T) {
+	router, repo, _ := newProtectedRouter(t)
+
+	for _, target := range []string{"/abc/", "/abc+"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `type="password"`) {
+			t.Errorf("Expected password form for %s, got %d", target, w.Code)
+		}
+		if strings.Contains(w.Body.String(), "example.com/secret") {
+			t.Errorf("Expected destination to stay hidden for %s", target)
+		}
+	}
+	if repo.urls[0].Visits != 0 {
+		t.Errorf("Expected no visit to be recorded")
+	}
+}
+
+func TestProtectedLinkRejectsWrongPassword(t *testing.T) {
+	router, _, _ := newProtectedRouter(t)
+
+	w := submitPassword(router, "/abc/", "wrong")
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401, got %d", w.Code)
+	}
+	if len(w.Result().Cookies()) != 0 {
+		t.Errorf("Expected no cookie for a wrong password")
+	}
+}
+
+func TestProtectedLinkUnlocksWithCookie(t *testing.T) {
+	router, repo, _ := newProtectedRouter(t)
+
+	w := submitPassword(router, "/abc/", "open sesame")
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("Expected status 303, got %d", w.Code)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || !cookies[0].HttpOnly {
+		t.Fatalf("Expected one HttpOnly unlock cookie, got %v", cookies)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/abc/", nil)
+	req.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "https://example.com/secret" {
+		t.Errorf("Expected redirect to destination, got %d %s", w.Code, w.Header().Get("Location"))
+	}
+	if repo.urls[0].Visits != 1 {
+		t.Errorf("Expected visit to be recorded once unlocked")
+	}
+}
+
+func TestProtectedLinkRejectsTamperedOrExpiredCookie(t *testing.T) {
+	_, repo, service := newProtectedRouter(t)
+	link := repo.urls[0]
+
+	expired := service.passwords.now().Add(-time.Second).Unix()
+	for _, value := range []string{
+		"9999999999.forged",
+		fmt.Sprintf("%d.%s", expired, service.passwords.signature(link, expired)),
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/abc/", nil)
+		req.AddCookie(&http.Cookie{Name: unlockCookiePrefix + "abc", Value: value})
+		if service.passwords.unlocked(req, link) {
+			t.Errorf("Expected cookie %q to be rejected", value)
+		}
+	}
+}
+
+func TestProtectedLinkThrottlesRepeatedFailures(t *testing.T) {
+	router, _, service := newProtectedRouter(t)
+	now := time.Unix(1_700_000_000, 0)
+	service.passwords.now = func() time.Time { return now }
+
+	for i := 0; i < maxPasswordFailures; i++ {
+		submitPassword(router, "/abc/", "wrong")
+	}
+	w := submitPassword(router, "/abc/", "open sesame")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status 429 after repeated failures, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected Retry-After header")
+	}
+
+	now = now.Add(failureWindow + time.Second)
+	w = submitPassword(router, "/abc/", "open sesame")
+	if w.Code != http.StatusSeeOther {
+		t.Errorf("Expected password to be accepted after the window, got %d", w.Code)
+	}
+}
+
+func TestHandleUrlShortenHashesPassword(t *testing.T) {
+	repo := newMockRepository()
+	service := New(repo, ":8080", "http://localhost", "api", 1)
+
+	w := httptest.NewRecorder()
+	service.handleUrlShorten(w, newShortenRequest(t, ShortLink{Url: "https://example.com", Password: "hunter2"}))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	hash := repo.urls[0].PasswordHash
+	if hash == "" || hash == "hunter2" {
+		t.Errorf("Expected password to be stored hashed, got %q", hash)
+	}
+}
+
+func TestProtectedLinkThrottlesParallelGuesses(t *testing.T) {
+	router, _, _ := newProtectedRouter(t)
+
+	var wg sync.WaitGroup
+	var checked atomic.Int32
+	for i := 0; i < 4*maxPasswordFailures; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if submitPassword(router, "/abc/", "wrong").Code == http.StatusUnauthorized {
+				checked.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if checked.Load() != maxPasswordFailures {
+		t.Errorf("Expected %d guesses to be checked, got %d", maxPasswordFailures, checked.Load())
+	}
+}
@@ -0,0 +1,143 @@
+package url
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"embed"
+	"encoding/base64"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	previewParam = "preview"
+	confirmParam = "confirm"
+	// confirmTtl is how long the continue link of an interstitial works.
+	confirmTtl = 10 * time.Minute
+)
+
+//go:embed templates/*.html
+var templateFiles embed.FS
+
+var templates = template.Must(template.ParseFS(templateFiles, "templates/*.html"))
+
+type previewPage struct {
+	Url          string
+	Destination  string
+	Title        string
+	CreatedAt    time.Time
+	Visits       int
+	ContinueUrl  string
+	Interstitial bool
+}
+
+// stripControlParams removes the query parameters meant for the shortener so
+// that they are not forwarded to the destination: preview=1, and a confirm
+// token the interstitial of link handed out. Other preview and confirm
+// parameters belong to the destination and are kept.
+func (s Service) stripControlParams(r *http.Request, link *Url) (previewRequested bool, confirmed bool, rawQuery string) {
+	var pairs []string
+	for _, pair := range splitQuery(r.URL.RawQuery) {
+		key, value, _ := strings.Cut(pair, "=")
+		switch {
+		case key == previewParam && value == "1":
+			previewRequested = true
+		case key == confirmParam && s.validConfirmation(link, value):
+			confirmed = true
+		default:
+			pairs = append(pairs, pair)
+		}
+	}
+	return previewRequested, confirmed, strings.Join(pairs, "&")
+}
+
+// confirmation returns a token for the continue link of link's interstitial,
+// valid for confirmTtl. Without it visitors could be sent past the
+// interstitial by a link that already carries the confirmation.
+func (s Service) confirmation(link *Url) string {
+	expires := s.now().Add(confirmTtl).Unix()
+	return fmt.Sprintf("%d.%s", expires, s.confirmationSignature(link, expires))
+}
+
+func (s Service) validConfirmation(link *Url, token string) bool {
+	rawExpires, signature, found := strings.Cut(token, ".")
+	if !found {
+		return false
+	}
+	expires, err := strconv.ParseInt(rawExpires, 10, 64)
+	if err != nil || s.now().Unix() > expires {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(s.confirmationSignature(link, expires)))
+}
+
+func (s Service) confirmationSignature(link *Url, expires int64) string {
+	mac := hmac.New(sha256.New, s.passwords.secret)
+	_, _ = fmt.Fprintf(mac, "confirm|%s|%d", link.Shortened, expires)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// isExternal reports whether destination leaves the host the shortener is
+// served on.
+func (s Service) isExternal(destination string) bool {
+	parsedDestination, err := url.Parse(destination)
+	if err != nil {
+		return true
+	}
+	parsedSelf, err := url.Parse(s.redirectUrl)
+	if err != nil || parsedSelf.Hostname() == "" {
+		return true
+	}
+	return !strings.EqualFold(canonicalHost(parsedDestination), canonicalHost(parsedSelf))
+}
+
+// canonicalHost lower-cases the host and drops the trailing dot of a fully
+// qualified name, which both still reach the same server.
+func canonicalHost(u *url.URL) string {
+	return strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+}
+
+func (s Service) renderPreview(writer http.ResponseWriter, r *http.Request, link *Url, destination string, interstitial bool) {
+	_, _, rawQuery := s.stripControlParams(r, link)
+	pairs := append(splitQuery(rawQuery), confirmParam+"="+s.confirmation(link))
+	continueUrl := url.URL{Path: "/" + link.Shortened + "/" + mux.Vars(r)["path"], RawQuery: strings.Join(pairs, "&")}
+
+	page := previewPage{
+		Url:          link.Url,
+		Destination:  destination,
+		Title:        link.Title,
+		CreatedAt:    link.CreatedAt,
+		Visits:       link.Visits,
+		ContinueUrl:  continueUrl.RequestURI(),
+		Interstitial: interstitial,
+	}
+	s.renderPage(writer, r, "preview.html", http.StatusOK, page)
+}
+
+func (s Service) renderPage(writer http.ResponseWriter, r *http.Request, name string, status int, data any) {
+	writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	writer.Header().Set("Cache-Control", "no-store")
+	writer.WriteHeader(status)
+	if err := templates.ExecuteTemplate(writer, name, data); err != nil {
+		zerolog.Ctx(r.Context()).Error().Err(err).Str("template", name).Msg("Failed to render page")
+	}
+}
+
+func (s Service) handlePreview(writer http.ResponseWriter, r *http.Request) {
+	link, err := s.repository.GetByValue(r.Context(), mux.Vars(r)["shortened"])
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusNotFound)
+		return
+	}
+	if s.refuseUnavailable(writer, r, link) || s.refuseBlocked(writer, r, link, link.Original) {
+		return
+	}
+	s.renderPreview(writer, r, link, link.Original, false)
+}
@@ -0,0 +1,161 @@
+package url
+
+import (
+	"github.com/gorilla/mux"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newPreviewRouter(link *Url) (*mux.Router, *mockRepository) {
+	repo := newMockRepository()
+	repo.urls[link.Id] = link
+	router := mux.NewRouter()
+	New(repo, ":8080", "http://localhost", "api", 1).RegisterHandlers(router)
+	return router, repo
+}
+
+func TestPreviewRouteRendersPageWithoutRecordingVisit(t *testing.T) {
+	created := time.Date(2025, 3, 14, 0, 0, 0, 0, time.UTC)
+	router, repo := newPreviewRouter(&Url{Id: 0, Original: "https://example.com/page", Shortened: "abc", Url: "http://localhost:8080/abc", Title: "Example <page>", Visits: 7, CreatedAt: created})
+
+	for _, target := range []string{"/abc+", "/abc/?preview=1"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200 for %s, got %d", target, w.Code)
+		}
+		body := w.Body.String()
+		for _, expected := range []string{"https://example.com/page", "Example &lt;page&gt;", "14 March 2025", "<dd>7</dd>"} {
+			if !strings.Contains(body, expected) {
+				t.Errorf("Expected preview for %s to contain %q", target, expected)
+			}
+		}
+	}
+	if repo.urls[0].Visits != 7 {
+		t.Errorf("Expected preview not to record a visit, got %d visits", repo.urls[0].Visits)
+	}
+}
+
+// continueLink returns the continue link of the interstitial page in body.
+func continueLink(t *testing.T, body string) string {
+	t.Helper()
+	match := regexp.MustCompile(`href="([^"]*)"[^>]*>Continue`).FindStringSubmatch(body)
+	if match == nil {
+		t.Fatalf("Expected a continue link, got %s", body)
+	}
+	return html.UnescapeString(match[1])
+}
+
+func TestInterstitialShownForExternalDestination(t *testing.T) {
+	router, repo := newPreviewRouter(&Url{Id: 0, Original: "https://example.com/page", Shortened: "abc", Interstitial: true})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/abc/", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected interstitial page, got status %d", w.Code)
+	}
+	link := continueLink(t, w.Body.String())
+	if !strings.HasPrefix(link, "/abc/?confirm=") {
+		t.Errorf("Expected continue link to confirm the visit, got %s", link)
+	}
+	if repo.urls[0].Visits != 0 {
+		t.Errorf("Expected interstitial not to record a visit")
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, link, nil))
+
+	if w.Code != http.StatusFound {
+		t.Errorf("Expected confirmed visit to redirect, got %d", w.Code)
+	}
+	if repo.urls[0].Visits != 1 {
+		t.Errorf("Expected confirmed visit to be recorded")
+	}
+}
+
+func TestInterstitialNotSkippedByForgedConfirmation(t *testing.T) {
+	router, repo := newPreviewRouter(&Url{Id: 0, Original: "https://example.com/page", Shortened: "abc", Interstitial: true})
+
+	for _, target := range []string{"/abc/?confirm=1", "/abc/?confirm=99999999999.forged"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected interstitial for %s, got status %d", target, w.Code)
+		}
+	}
+	if repo.urls[0].Visits != 0 {
+		t.Errorf("Expected forged confirmations not to record a visit")
+	}
+}
+
+func TestConfirmationExpires(t *testing.T) {
+	link := &Url{Id: 0, Original: "https://example.com/page", Shortened: "abc", Interstitial: true}
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	service := New(newMockRepository(), ":8080", "http://localhost", "api", 1)
+	service.now = func() time.Time { return now }
+	token := service.confirmation(link)
+
+	if !service.validConfirmation(link, token) {
+		t.Errorf("Expected fresh confirmation to be valid")
+	}
+	if service.validConfirmation(&Url{Shortened: "other"}, token) {
+		t.Errorf("Expected confirmation to be bound to its link")
+	}
+	now = now.Add(confirmTtl + time.Second)
+	if service.validConfirmation(link, token) {
+		t.Errorf("Expected confirmation to expire after %s", confirmTtl)
+	}
+}
+
+func TestInterstitialSkippedForInternalDestination(t *testing.T) {
+	router, _ := newPreviewRouter(&Url{Id: 0, Original: "http://localhost/docs", Shortened: "abc", Interstitial: true})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/abc/", nil))
+
+	if w.Code != http.StatusFound {
+		t.Errorf("Expected internal destination to redirect directly, got %d", w.Code)
+	}
+}
+
+func TestControlParamsAreNotForwarded(t *testing.T) {
+	router, _ := newPreviewRouter(&Url{Id: 0, Original: "https://example.com/", Shortened: "abc", Interstitial: true, Passthrough: Passthrough{Query: true}})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/abc/?ref=1&preview=yes&confirm=1", nil))
+	w2 := httptest.NewRecorder()
+	router.ServeHTTP(w2, httptest.NewRequest(http.MethodGet, continueLink(t, w.Body.String()), nil))
+
+	if location := w2.Header().Get("Location"); location != "https://example.com/?ref=1&preview=yes&confirm=1" {
+		t.Errorf("Expected only the confirmation to be stripped, got %s", location)
+	}
+}
+
+func TestPreviewRouteRefusesUnavailableLinks(t *testing.T) {
+	notYet := &Url{Id: 0, Original: "https://example.com/page", Shortened: "abc", NotBefore: time.Now().Add(time.Hour)}
+	router, _ := newPreviewRouter(notYet)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/abc+", nil))
+	if w.Code != http.StatusServiceUnavailable || strings.Contains(w.Body.String(), notYet.Original) {
+		t.Errorf("Expected a link that is not active yet to hide its destination, got %d", w.Code)
+	}
+
+	repo := newMockRepository()
+	repo.urls[0] = &Url{Id: 0, Original: "https://evil.com/page", Shortened: "abc"}
+	service, _ := newBlocklistService(t, repo, ".evil.com\n")
+	router = mux.NewRouter()
+	service.RegisterHandlers(router)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/abc+", nil))
+	if w.Code != http.StatusGone {
+		t.Errorf("Expected a blocked destination to be refused, got %d", w.Code)
+	}
+}
@@ -0,0 +1,221 @@
+package url
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/skip2/go-qrcode"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultQrSize   = 256
+	minQrSize       = 32
+	maxQrSize       = 2048
+	defaultQrMargin = 4
+	maxQrMargin     = 32
+)
+
+var qrLevels = map[string]qrcode.RecoveryLevel{
+	"L": qrcode.Low,
+	"M": qrcode.Medium,
+	"Q": qrcode.High,
+	"H": qrcode.Highest,
+}
+
+type qrOptions struct {
+	format     string
+	size       int
+	level      qrcode.RecoveryLevel
+	margin     int
+	foreground color.RGBA
+	background color.RGBA
+}
+
+func parseQrOptions(values url.Values) (qrOptions, error) {
+	options := qrOptions{
+		format:     "png",
+		size:       defaultQrSize,
+		level:      qrcode.Medium,
+		margin:     defaultQrMargin,
+		foreground: color.RGBA{A: 0xff},
+		background: color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff},
+	}
+
+	switch format := strings.ToLower(values.Get("format")); format {
+	case "":
+	case "png", "svg":
+		options.format = format
+	default:
+		return options, fmt.Errorf("format must be png or svg")
+	}
+
+	if size := values.Get("size"); size != "" {
+		parsed, err := strconv.Atoi(size)
+		if err != nil || parsed < minQrSize || parsed > maxQrSize {
+			return options, fmt.Errorf("size must be between %d and %d", minQrSize, maxQrSize)
+		}
+		options.size = parsed
+	}
+
+	if level := values.Get("level"); level != "" {
+		parsed, exists := qrLevels[strings.ToUpper(level)]
+		if !exists {
+			return options, fmt.Errorf("level must be L, M, Q or H")
+		}
+		options.level = parsed
+	}
+
+	if margin := values.Get("margin"); margin != "" {
+		parsed, err := strconv.Atoi(margin)
+		if err != nil || parsed < 0 || parsed > maxQrMargin {
+			return options, fmt.Errorf("margin must be between 0 and %d", maxQrMargin)
+		}
+		options.margin = parsed
+	}
+
+	var err error
+	if fg := values.Get("fg"); fg != "" {
+		if options.foreground, err = parseHexColor(fg); err != nil {
+			return options, err
+		}
+	}
+	if bg := values.Get("bg"); bg != "" {
+		if options.background, err = parseHexColor(bg); err != nil {
+			return options, err
+		}
+	}
+	return options, nil
+}
+
+// parseHexColor accepts RGB or RRGGBB, with or without a leading #.
+func parseHexColor(value string) (color.RGBA, error) {
+	hex := strings.TrimPrefix(value, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	parsed, err := strconv.ParseUint(hex, 16, 32)
+	if len(hex) != 6 || err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid colour %q", value)
+	}
+	return color.RGBA{R: uint8(parsed >> 16), G: uint8(parsed >> 8), B: uint8(parsed), A: 0xff}, nil
+}
+
+// qrModules returns the QR code for content as a square of modules, dark
+// modules being true, surrounded by a quiet zone of margin modules.
+func qrModules(content string, options qrOptions) ([][]bool, error) {
+	code, err := qrcode.New(content, options.level)
+	if err != nil {
+		return nil, err
+	}
+	code.DisableBorder = true
+	bitmap := code.Bitmap()
+
+	size := len(bitmap) + 2*options.margin
+	modules := make([][]bool, size)
+	for y := range modules {
+		modules[y] = make([]bool, size)
+	}
+	for y, row := range bitmap {
+		copy(modules[y+options.margin][options.margin:], row)
+	}
+	return modules, nil
+}
+
+func renderQrPng(modules [][]bool, options qrOptions) ([]byte, error) {
+	scale := options.size / len(modules)
+	if scale < 1 {
+		return nil, fmt.Errorf("size %d is too small for this link, use at least %d", options.size, len(modules))
+	}
+	offset := (options.size - scale*len(modules)) / 2
+
+	palette := color.Palette{options.background, options.foreground}
+	img := image.NewPaletted(image.Rect(0, 0, options.size, options.size), palette)
+	for y, row := range modules {
+		for x, dark := range row {
+			if !dark {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetColorIndex(offset+x*scale+dx, offset+y*scale+dy, 1)
+				}
+			}
+		}
+	}
+
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, img); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func renderQrSvg(modules [][]bool, options qrOptions) []byte {
+	var buffer bytes.Buffer
+	fmt.Fprintf(&buffer, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		options.size, options.size, len(modules), len(modules))
+	fmt.Fprintf(&buffer, `<rect width="100%%" height="100%%" fill="%s"/>`, hexColor(options.background))
+	fmt.Fprintf(&buffer, `<path fill="%s" d="`, hexColor(options.foreground))
+	for y, row := range modules {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&buffer, "M%d %dh1v1h-1z", x, y)
+			}
+		}
+	}
+	buffer.WriteString(`"/></svg>`)
+	return buffer.Bytes()
+}
+
+func hexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+func (s Service) handleQrCode(writer http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(writer, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	options, err := parseQrOptions(r.URL.Query())
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	link, err := s.repository.GetById(r.Context(), id)
+	if err != nil {
+		http.Error(writer, "Failed to look up URL", http.StatusInternalServerError)
+		return
+	}
+	if link == nil || link.Owner != ownerFrom(r.Context()) {
+		http.Error(writer, "URL not found", http.StatusNotFound)
+		return
+	}
+
+	modules, err := qrModules(link.Url, options)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	if options.format == "svg" {
+		writer.Header().Set("Content-Type", "image/svg+xml")
+		_, _ = writer.Write(renderQrSvg(modules, options))
+		return
+	}
+	encoded, err := renderQrPng(modules, options)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writer.Header().Set("Content-Type", "image/png")
+	_, _ = writer.Write(encoded)
+}
@@ -0,0 +1,116 @@
+package url
+
+import (
+	"fmt"
+	"github.com/gorilla/mux"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func requestQr(t *testing.T, query string) *httptest.ResponseRecorder {
+	repo := newMockRepository()
+	repo.urls[0] = &Url{Id: 0, Original: "https://example.com", Shortened: "a", Url: "http://localhost:8080/a"}
+	router := mux.NewRouter()
+	New(repo, ":8080", "http://localhost", "api", 1).RegisterHandlers(router)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/urls/0/qr"+query, nil))
+	return w
+}
+
+func TestParseHexColor(t *testing.T) {
+	parsed, err := parseHexColor("#0a0")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if parsed != (color.RGBA{R: 0, G: 0xaa, B: 0, A: 0xff}) {
+		t.Errorf("Expected #00aa00, got %v", parsed)
+	}
+	if _, err := parseHexColor("red"); err == nil {
+		t.Errorf("Expected error for named colour, got nil")
+	}
+}
+
+func TestParseQrOptionsRejectsInvalidValues(t *testing.T) {
+	for _, query := range []string{"format=gif", "size=10", "level=X", "margin=-1", "fg=nope"} {
+		values, _ := url.ParseQuery(query)
+		if _, err := parseQrOptions(values); err == nil {
+			t.Errorf("Expected error for %s, got nil", query)
+		}
+	}
+}
+
+func TestHandleQrCodeReturnsPngOfRequestedSize(t *testing.T) {
+	w := requestQr(t, "?size=300&margin=2&fg=ff0000&bg=00ff00&level=H")
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Content-Type") != "image/png" {
+		t.Errorf("Expected image/png, got %s", w.Header().Get("Content-Type"))
+	}
+	img, err := png.Decode(w.Body)
+	if err != nil {
+		t.Fatalf("Expected a valid PNG, got %v", err)
+	}
+	if img.Bounds().Dx() != 300 || img.Bounds().Dy() != 300 {
+		t.Errorf("Expected 300x300 image, got %v", img.Bounds())
+	}
+	if r, g, b, _ := img.At(0, 0).RGBA(); r != 0 || g != 0xffff || b != 0 {
+		t.Errorf("Expected background colour in the corner, got %v", img.At(0, 0))
+	}
+	if r, g, b, _ := img.At(150, 150).RGBA(); !(r == 0xffff && g == 0 && b == 0) && !(r == 0 && g == 0xffff && b == 0) {
+		t.Errorf("Expected only foreground and background colours, got %v", img.At(150, 150))
+	}
+}
+
+func TestHandleQrCodeReturnsSvg(t *testing.T) {
+	w := requestQr(t, "?format=svg&fg=112233")
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if w.Header().Get("Content-Type") != "image/svg+xml" {
+		t.Errorf("Expected image/svg+xml, got %s", w.Header().Get("Content-Type"))
+	}
+	body := w.Body.String()
+	if !strings.HasPrefix(body, "<svg") || !strings.Contains(body, `fill="#112233"`) {
+		t.Errorf("Expected SVG with foreground colour, got %s", body)
+	}
+}
+
+func TestHandleQrCodeNotFound(t *testing.T) {
+	repo := newMockRepository()
+	service := New(repo, ":8080", "http://localhost", "api", 1)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/urls/5/qr", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "5"})
+	w := httptest.NewRecorder()
+	service.handleQrCode(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", w.Code)
+	}
+}
+
+func TestQrModulesAddsQuietZone(t *testing.T) {
+	modules, err := qrModules("http://localhost:8080/a", qrOptions{level: qrLevels["M"], margin: 4})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if modules[0][0] || modules[3][3] {
+		t.Errorf("Expected quiet zone to be light")
+	}
+	if !modules[4][4] {
+		t.Errorf("Expected finder pattern to start after the quiet zone")
+	}
+	svg := string(renderQrSvg(modules, qrOptions{size: 100}))
+	if !strings.Contains(svg, fmt.Sprintf(`viewBox="0 0 %d %d"`, len(modules), len(modules))) {
+		t.Errorf("Expected SVG viewBox to span every module")
+	}
+}
@@ -0,0 +1,95 @@
+package url
+
+import (
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"slices"
+)
+
+const (
+	CacheDefault = ""
+	CacheNoStore = "no-store"
+	CachePrivate = "private"
+	CachePublic  = "public"
+)
+
+// bodyMethods are accepted on short links whose policy is 307 or 308, which
+// carry the request body on to an API behind the link.
+var bodyMethods = []string{http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+const maxCacheMaxAge = 365 * 24 * 60 * 60
+
+// RedirectPolicy is how a link answers visitors: which redirect status it
+// uses and how long clients and proxies may cache that answer.
+type RedirectPolicy struct {
+	Status int    `json:"redirect_status,omitempty"`
+	Cache  string `json:"cache_control,omitempty"`
+	MaxAge int    `json:"cache_max_age,omitempty"`
+}
+
+func (p RedirectPolicy) validate() error {
+	switch p.Status {
+	case 0, http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return fmt.Errorf("redirect_status must be 301, 302, 307 or 308")
+	}
+	switch p.Cache {
+	case CacheDefault, CacheNoStore:
+		if p.MaxAge != 0 {
+			return fmt.Errorf("cache_max_age requires cache_control %s or %s", CachePrivate, CachePublic)
+		}
+	case CachePrivate, CachePublic:
+		if p.MaxAge < 0 || p.MaxAge > maxCacheMaxAge {
+			return fmt.Errorf("cache_max_age must be between 0 and %d", maxCacheMaxAge)
+		}
+	default:
+		return fmt.Errorf("cache_control must be %s, %s or %s", CacheNoStore, CachePrivate, CachePublic)
+	}
+	return nil
+}
+
+func (p RedirectPolicy) status() int {
+	if p.Status == 0 {
+		return http.StatusFound
+	}
+	return p.Status
+}
+
+func (p RedirectPolicy) preservesMethod() bool {
+	return p.Status == http.StatusTemporaryRedirect || p.Status == http.StatusPermanentRedirect
+}
+
+// allowsMethod matches GET and HEAD on every short link, bodyMethods on links
+// whose policy preserves the method and the password form's POST. Anything
+// else, including the API paths the redirect routes also match, gets 405.
+func (s Service) allowsMethod(r *http.Request, match *mux.RouteMatch) bool {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return true
+	}
+	link, err := s.repository.GetByValue(r.Context(), shortCodeOf(r.URL.Path))
+	if err == nil && (link.Redirect.preservesMethod() && slices.Contains(bodyMethods, r.Method) ||
+		link.PasswordHash != "" && r.Method == http.MethodPost) {
+		return true
+	}
+	match.MatchErr = mux.ErrMethodMismatch
+	return false
+}
+
+func (p RedirectPolicy) cacheControl() string {
+	switch p.Cache {
+	case CacheNoStore:
+		return "no-store"
+	case CachePrivate, CachePublic:
+		return fmt.Sprintf("%s, max-age=%d", p.Cache, p.MaxAge)
+	}
+	return ""
+}
+
+// Redirect sends the visitor to destination according to the policy.
+func (p RedirectPolicy) Redirect(writer http.ResponseWriter, r *http.Request, destination string) {
+	if cacheControl := p.cacheControl(); cacheControl != "" {
+		writer.Header().Set("Cache-Control", cacheControl)
+	}
+	http.Redirect(writer, r, destination, p.status())
+}
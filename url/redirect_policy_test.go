@@ -0,0 +1,121 @@
+package url
+
+import (
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRedirectPolicyValidate(t *testing.T) {
+	cases := []struct {
+		policy RedirectPolicy
+		valid  bool
+	}{
+		{RedirectPolicy{}, true},
+		{RedirectPolicy{Status: http.StatusMovedPermanently, Cache: CachePublic, MaxAge: 3600}, true},
+		{RedirectPolicy{Status: http.StatusPermanentRedirect, Cache: CacheNoStore}, true},
+		{RedirectPolicy{Status: http.StatusOK}, false},
+		{RedirectPolicy{Cache: "forever"}, false},
+		{RedirectPolicy{Cache: CacheNoStore, MaxAge: 10}, false},
+		{RedirectPolicy{Cache: CachePrivate, MaxAge: -1}, false},
+	}
+	for _, c := range cases {
+		if err := c.policy.validate(); (err == nil) != c.valid {
+			t.Errorf("Expected valid=%v for %+v, got %v", c.valid, c.policy, err)
+		}
+	}
+}
+
+func TestHandleUrlRedirectUsesLinkPolicy(t *testing.T) {
+	cases := []struct {
+		policy       RedirectPolicy
+		status       int
+		cacheControl string
+	}{
+		{RedirectPolicy{}, http.StatusFound, ""},
+		{RedirectPolicy{Status: http.StatusMovedPermanently, Cache: CachePublic, MaxAge: 86400}, http.StatusMovedPermanently, "public, max-age=86400"},
+		{RedirectPolicy{Status: http.StatusTemporaryRedirect, Cache: CacheNoStore}, http.StatusTemporaryRedirect, "no-store"},
+		{RedirectPolicy{Status: http.StatusPermanentRedirect, Cache: CachePrivate}, http.StatusPermanentRedirect, "private, max-age=0"},
+	}
+	for _, c := range cases {
+		repo := newMockRepository()
+		repo.urls[0] = &Url{Id: 0, Original: "https://example.com", Shortened: "abc", Redirect: c.policy}
+		service := New(repo, ":8080", "http://localhost", "api", 1)
+
+		req := httptest.NewRequest(http.MethodGet, "/abc/", nil)
+		req = mux.SetURLVars(req, map[string]string{"shortened": "abc"})
+		w := httptest.NewRecorder()
+		service.handleUrlRedirect(w, req)
+
+		if w.Code != c.status {
+			t.Errorf("Expected status %d, got %d", c.status, w.Code)
+		}
+		if w.Header().Get("Cache-Control") != c.cacheControl {
+			t.Errorf("Expected Cache-Control %q, got %q", c.cacheControl, w.Header().Get("Cache-Control"))
+		}
+	}
+}
+
+func TestHandleUrlShortenRejectsInvalidRedirectStatus(t *testing.T) {
+	service := New(newMockRepository(), ":8080", "http://localhost", "api", 1)
+
+	short := ShortLink{Url: "https://example.com", RedirectPolicy: RedirectPolicy{Status: http.StatusOK}}
+	w := httptest.NewRecorder()
+	service.handleUrlShorten(w, newShortenRequest(t, short))
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+}
+
+func TestRegisterHandlersPreservesMethodWith308(t *testing.T) {
+	repo := newMockRepository()
+	repo.urls[0] = &Url{Id: 0, Original: "https://api.example.com/hook", Shortened: "abc", Redirect: RedirectPolicy{Status: http.StatusPermanentRedirect}}
+	router := mux.NewRouter()
+	New(repo, ":8080", "http://localhost", "api", 1).RegisterHandlers(router)
+
+	req := httptest.NewRequest(http.MethodPost, "/abc/", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusPermanentRedirect {
+		t.Errorf("Expected status 308, got %d", w.Code)
+	}
+}
+
+func TestRegisterHandlersRefusesOtherMethodsWithoutPreservingPolicy(t *testing.T) {
+	repo := newMockRepository()
+	repo.urls[0] = &Url{Id: 0, Original: "https://example.com", Shortened: "abc"}
+	router := mux.NewRouter()
+	New(repo, ":8080", "http://localhost", "api", 1).RegisterHandlers(router)
+
+	for _, target := range []string{"/abc/", "/abc/some/path", "/api/v1/urls/0"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPut, target, nil))
+
+		if w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("Expected status 405 for PUT %s, got %d", target, w.Code)
+		}
+	}
+	if repo.urls[0].Visits != 0 {
+		t.Errorf("Expected refused requests not to record a visit, got %d", repo.urls[0].Visits)
+	}
+}
+
+func TestHeadRequestsAreNotRecordedAsVisits(t *testing.T) {
+	repo := newMockRepository()
+	repo.urls[0] = &Url{Id: 0, Original: "https://example.com", Shortened: "abc"}
+	router := mux.NewRouter()
+	New(repo, ":8080", "http://localhost", "api", 1).RegisterHandlers(router)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodHead, "/abc/", nil))
+
+	if w.Code != http.StatusFound {
+		t.Errorf("Expected status 302, got %d", w.Code)
+	}
+	if repo.urls[0].Visits != 0 {
+		t.Errorf("Expected HEAD not to record a visit, got %d", repo.urls[0].Visits)
+	}
+}
@@ -0,0 +1,30 @@
+package url
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"thesilentcoder.com/m/fetch"
+	"time"
+)
+
+// maxResolveTime bounds how long shortening waits for a redirect chain to be
+// followed.
+const maxResolveTime = 15 * time.Second
+
+var errResolveDisabled = errors.New("resolving redirects is not enabled")
+
+// resolveRedirects follows the redirect chain of destination and returns its
+// hops, the last one being the URL the link should point at.
+func (s Service) resolveRedirects(ctx context.Context, destination string) ([]fetch.Hop, error) {
+	if s.resolver == nil {
+		return nil, errResolveDisabled
+	}
+	ctx, cancel := context.WithTimeout(ctx, maxResolveTime)
+	defer cancel()
+	chain, err := s.resolver.Resolve(ctx, destination)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve redirects: %w", err)
+	}
+	return chain, nil
+}
@@ -0,0 +1,91 @@
+package url
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"thesilentcoder.com/m/fetch"
+)
+
+func newRedirectingServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/click" {
+			http.Redirect(writer, r, "/landing?ref=mail", http.StatusFound)
+		}
+	}))
+}
+
+func TestHandleUrlShortenResolvesRedirects(t *testing.T) {
+	server := newRedirectingServer()
+	defer server.Close()
+	repo := newMockRepository()
+	service := New(repo, ":8080", "http://localhost", "api", 1, WithRedirectResolution(fetch.New(fetch.Config{AllowPrivateNetworks: true})))
+
+	w := httptest.NewRecorder()
+	service.handleUrlShorten(w, newShortenRequest(t, ShortLink{Url: server.URL + "/click", ResolveRedirects: true}))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	link := repo.urls[0]
+	if link.Original != server.URL+"/landing?ref=mail" {
+		t.Errorf("Expected final URL to be stored, got %s", link.Original)
+	}
+	if len(link.RedirectChain) != 2 || link.RedirectChain[0].Url != server.URL+"/click" || link.RedirectChain[0].Status != http.StatusFound {
+		t.Errorf("Expected chain to be kept, got %+v", link.RedirectChain)
+	}
+}
+
+func TestHandleUrlShortenRefusesResolvingPrivateTargets(t *testing.T) {
+	server := newRedirectingServer()
+	defer server.Close()
+	service := New(newMockRepository(), ":8080", "http://localhost", "api", 1, WithRedirectResolution(fetch.New(fetch.Config{})))
+
+	w := httptest.NewRecorder()
+	service.handleUrlShorten(w, newShortenRequest(t, ShortLink{Url: server.URL + "/click", ResolveRedirects: true}))
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+}
+
+func TestHandleUrlShortenWithoutResolver(t *testing.T) {
+	service := New(newMockRepository(), ":8080", "http://localhost", "api", 1)
+
+	w := httptest.NewRecorder()
+	service.handleUrlShorten(w, newShortenRequest(t, ShortLink{Url: "https://example.com", ResolveRedirects: true}))
+
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("Expected status 501, got %d", w.Code)
+	}
+}
+
+func TestHandleUrlShortenValidatesBeforeResolving(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		requests.Add(1)
+	}))
+	defer server.Close()
+	resolver := WithRedirectResolution(fetch.New(fetch.Config{AllowPrivateNetworks: true}))
+	cases := map[string]*Service{
+		"disallowed scheme": New(newMockRepository(), ":8080", "http://localhost", "api", 1, resolver, WithAllowedSchemes([]string{"https"})),
+		"invalid campaign":  New(newMockRepository(), ":8080", "http://localhost", "api", 1, resolver),
+	}
+	for name, service := range cases {
+		short := ShortLink{Url: server.URL + "/click", ResolveRedirects: true}
+		if name == "invalid campaign" {
+			short.Campaign = strings.Repeat("c", maxLabelLength+1)
+		}
+		w := httptest.NewRecorder()
+		service.handleUrlShorten(w, newShortenRequest(t, short))
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %s, got %d", name, w.Code)
+		}
+	}
+	if requests.Load() != 0 {
+		t.Errorf("Expected nothing to be fetched for invalid requests, got %d requests", requests.Load())
+	}
+}
@@ -0,0 +1,105 @@
+package url
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxScheduleWindows = 50
+
+// localLayouts are accepted for times without an offset; they are read in the
+// service's configured location.
+var localLayouts = []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
+// ScheduleEntry is a window as submitted on shorten. Start or End may be left
+// empty for a window that is open on that side.
+type ScheduleEntry struct {
+	Start       string `json:"start,omitempty"`
+	End         string `json:"end,omitempty"`
+	Destination string `json:"destination"`
+}
+
+// ScheduleWindow sends visitors to Destination between Start (inclusive) and
+// End (exclusive). A zero Start or End leaves that side open.
+type ScheduleWindow struct {
+	Start       time.Time
+	End         time.Time
+	Destination string
+}
+
+func (w ScheduleWindow) contains(now time.Time) bool {
+	return (w.Start.IsZero() || !now.Before(w.Start)) && (w.End.IsZero() || now.Before(w.End))
+}
+
+type notYetAvailablePage struct {
+	ActiveFrom time.Time
+}
+
+// parseTime reads RFC 3339 times as they are and times without an offset in
+// location.
+func parseTime(value string, location *time.Location) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+		return parsed, nil
+	}
+	for _, layout := range localLayouts {
+		if parsed, err := time.ParseInLocation(layout, value, location); err == nil {
+			return parsed, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", value)
+}
+
+func parseSchedule(entries []ScheduleEntry, location *time.Location) ([]ScheduleWindow, error) {
+	if len(entries) > maxScheduleWindows {
+		return nil, fmt.Errorf("at most %d schedule windows are allowed", maxScheduleWindows)
+	}
+	var windows []ScheduleWindow
+	for i, entry := range entries {
+		if entry.Start == "" && entry.End == "" {
+			return nil, fmt.Errorf("schedule window %d needs a start or an end", i+1)
+		}
+		window := ScheduleWindow{Destination: entry.Destination}
+		var err error
+		if entry.Start != "" {
+			if window.Start, err = parseTime(entry.Start, location); err != nil {
+				return nil, err
+			}
+		}
+		if entry.End != "" {
+			if window.End, err = parseTime(entry.End, location); err != nil {
+				return nil, err
+			}
+		}
+		if !window.Start.IsZero() && !window.End.IsZero() && !window.Start.Before(window.End) {
+			return nil, fmt.Errorf("schedule window %d ends before it starts", i+1)
+		}
+		parsed, err := url.ParseRequestURI(entry.Destination)
+		if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			return nil, fmt.Errorf("schedule window %d has an invalid destination", i+1)
+		}
+		windows = append(windows, window)
+	}
+	return windows, nil
+}
+
+// scheduledDestination returns the destination of the first window open at
+// now, if any.
+func scheduledDestination(windows []ScheduleWindow, now time.Time) (string, bool) {
+	for _, window := range windows {
+		if window.contains(now) {
+			return window.Destination, true
+		}
+	}
+	return "", false
+}
+
+func (s Service) renderNotYetAvailable(writer http.ResponseWriter, r *http.Request, link *Url) {
+	wait := link.NotBefore.Sub(s.now())
+	writer.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+	s.renderPage(writer, r, "not_yet_available.html", http.StatusServiceUnavailable, notYetAvailablePage{ActiveFrom: link.NotBefore.In(s.location)})
+}
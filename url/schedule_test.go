@@ -0,0 +1,106 @@
+package url
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func scheduledLink() *Url {
+	return &Url{Id: 0, Original: "https://example.com", Shortened: "event", Schedule: []ScheduleWindow{
+		{Start: time.Date(2025, 6, 1, 9, 0, 0, 0, time.UTC), End: time.Date(2025, 6, 1, 17, 0, 0, 0, time.UTC), Destination: "https://example.com/live"},
+		{Start: time.Date(2025, 6, 1, 17, 0, 0, 0, time.UTC), Destination: "https://example.com/replay"},
+	}}
+}
+
+func launchLink() *Url {
+	return &Url{Id: 0, Original: "https://example.com/launch", Shortened: "launch", NotBefore: time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+func TestRedirectFollowsOpenScheduleWindow(t *testing.T) {
+	cases := map[time.Time]string{
+		time.Date(2025, 6, 1, 8, 59, 0, 0, time.UTC): "https://example.com",
+		time.Date(2025, 6, 1, 9, 0, 0, 0, time.UTC):  "https://example.com/live",
+		time.Date(2025, 6, 1, 17, 0, 0, 0, time.UTC): "https://example.com/replay",
+	}
+	for now, expected := range cases {
+		service, _ := newRedirectService(scheduledLink())
+		service.now = func() time.Time { return now }
+
+		w := visit(t, service, "event")
+
+		if location := w.Header().Get("Location"); location != expected {
+			t.Errorf("Expected %s at %s, got %s", expected, now, location)
+		}
+	}
+}
+
+func TestRedirectShowsNotYetAvailablePage(t *testing.T) {
+	now := time.Date(2025, 6, 1, 11, 0, 0, 0, time.UTC)
+	service, _ := newRedirectService(launchLink())
+	service.now = func() time.Time { return now }
+
+	w := visit(t, service, "launch")
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected status 503, got %d", w.Code)
+	}
+	if retry := w.Header().Get("Retry-After"); retry != "3601" {
+		t.Errorf("Expected Retry-After 3601, got %s", retry)
+	}
+	if !strings.Contains(w.Body.String(), "not available yet") {
+		t.Errorf("Expected not yet available page, got %s", w.Body.String())
+	}
+}
+
+func TestRedirectAfterNotBefore(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	service, _ := newRedirectService(launchLink())
+	service.now = func() time.Time { return now }
+
+	w := visit(t, service, "launch")
+
+	if location := w.Header().Get("Location"); location != "https://example.com/launch" {
+		t.Errorf("Expected redirect to launch page, got %d %s", w.Code, location)
+	}
+}
+
+func TestParseTimeUsesLocationWithoutOffset(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("time zone database not available")
+	}
+
+	local, err := parseTime("2025-06-01T09:00", berlin)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if expected := time.Date(2025, 6, 1, 7, 0, 0, 0, time.UTC); !local.Equal(expected) {
+		t.Errorf("Expected %s, got %s", expected, local.UTC())
+	}
+
+	explicit, err := parseTime("2025-06-01T09:00:00Z", berlin)
+	if err != nil || !explicit.Equal(time.Date(2025, 6, 1, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected explicit offset to win, got %s (%v)", explicit, err)
+	}
+}
+
+func TestHandleUrlShortenRejectsInvalidSchedule(t *testing.T) {
+	service := New(newMockRepository(), ":8080", "http://localhost", "api", 1)
+	cases := []ShortLink{
+		{Url: "https://example.com", Schedule: []ScheduleEntry{{Destination: "https://example.com/a"}}},
+		{Url: "https://example.com", Schedule: []ScheduleEntry{{Start: "2025-06-02", End: "2025-06-01", Destination: "https://example.com/a"}}},
+		{Url: "https://example.com", Schedule: []ScheduleEntry{{Start: "2025-06-01", Destination: "not a url"}}},
+		{Url: "https://example.com", NotBefore: "tomorrow"},
+	}
+	for _, short := range cases {
+		w := httptest.NewRecorder()
+		service.handleUrlShorten(w, newShortenRequest(t, short))
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %+v, got %d", short, w.Code)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package url
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"thesilentcoder.com/m/useragent"
+)
+
+const (
+	maxTargetingRules = 50
+	fallbackRule      = "fallback"
+)
+
+// TargetingRule sends visitors matching every one of its non-empty criteria
+// to its own destination. Within a criterion any listed value matches.
+type TargetingRule struct {
+	Name        string   `json:"name,omitempty"`
+	Os          []string `json:"os,omitempty"`
+	Device      []string `json:"device,omitempty"`
+	Browser     []string `json:"browser,omitempty"`
+	Language    []string `json:"language,omitempty"`
+	Country     []string `json:"country,omitempty"`
+	Destination string   `json:"destination"`
+}
+
+// visitor is what targeting rules are evaluated against.
+type visitor struct {
+	agent     useragent.Agent
+	languages []string
+	country   string
+}
+
+func newVisitor(r *http.Request, countryHeader string) visitor {
+	v := visitor{
+		agent:     useragent.Parse(r.UserAgent()),
+		languages: acceptedLanguages(r.Header.Get("Accept-Language")),
+	}
+	if countryHeader != "" {
+		v.country = strings.ToUpper(strings.TrimSpace(r.Header.Get(countryHeader)))
+	}
+	return v
+}
+
+// acceptedLanguages returns the lower-cased language tags of an
+// Accept-Language header, leaving out the ones with q=0.
+func acceptedLanguages(header string) []string {
+	var languages []string
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if tag == "" || tag == "*" {
+			continue
+		}
+		if q, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			if weight, err := strconv.ParseFloat(q, 64); err == nil && weight <= 0 {
+				continue
+			}
+		}
+		languages = append(languages, strings.ToLower(tag))
+	}
+	return languages
+}
+
+func (rule TargetingRule) matches(v visitor) bool {
+	if len(rule.Os) > 0 && !slices.Contains(rule.Os, v.agent.Os) {
+		return false
+	}
+	if len(rule.Device) > 0 && !slices.Contains(rule.Device, v.agent.Device) {
+		return false
+	}
+	if len(rule.Browser) > 0 && !slices.Contains(rule.Browser, v.agent.Browser) {
+		return false
+	}
+	if len(rule.Country) > 0 && !slices.Contains(rule.Country, v.country) {
+		return false
+	}
+	if len(rule.Language) > 0 && !slices.ContainsFunc(rule.Language, v.acceptsLanguage) {
+		return false
+	}
+	return true
+}
+
+// acceptsLanguage matches "pt" against "pt" and "pt-br", and "pt-br" only
+// against itself.
+func (v visitor) acceptsLanguage(language string) bool {
+	for _, accepted := range v.languages {
+		if accepted == language || strings.HasPrefix(accepted, language+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeRules validates rules and fills in default names, which are what
+// the stats report matches under.
+func normalizeRules(rules []TargetingRule) ([]TargetingRule, error) {
+	if len(rules) > maxTargetingRules {
+		return nil, fmt.Errorf("at most %d targeting rules are allowed", maxTargetingRules)
+	}
+	var result []TargetingRule
+	var names []string
+	for i, rule := range rules {
+		rule.Name = strings.TrimSpace(rule.Name)
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule_%d", i+1)
+		}
+		if rule.Name == fallbackRule || slices.Contains(names, rule.Name) {
+			return nil, fmt.Errorf("targeting rule name %q is reserved or used twice", rule.Name)
+		}
+		names = append(names, rule.Name)
+
+		parsed, err := url.ParseRequestURI(rule.Destination)
+		if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			return nil, fmt.Errorf("targeting rule %q has an invalid destination", rule.Name)
+		}
+		rule.Os = lowerAll(rule.Os)
+		rule.Device = lowerAll(rule.Device)
+		rule.Browser = lowerAll(rule.Browser)
+		rule.Language = lowerAll(rule.Language)
+		rule.Country = upperAll(rule.Country)
+		result = append(result, rule)
+	}
+	return result, nil
+}
+
+func lowerAll(values []string) []string {
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		result = append(result, strings.ToLower(strings.TrimSpace(value)))
+	}
+	return result
+}
+
+func upperAll(values []string) []string {
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		result = append(result, strings.ToUpper(strings.TrimSpace(value)))
+	}
+	return result
+}
+
+// matchRule returns the first rule the visitor matches, or nil.
+func matchRule(rules []TargetingRule, v visitor) *TargetingRule {
+	for i := range rules {
+		if rules[i].matches(v) {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+// target is where a visit is sent and which of the link's options chose it.
+type target struct {
+	destination string
+	rule        string
+	variant     string
+	pin         bool
+	failover    bool
+	archived    bool
+}
+
+// resolveTarget picks the destination for a visit: the first matching
+// targeting rule, otherwise the open schedule window, otherwise one of the
+// weighted variants, otherwise Original. Original gives way to the fallback
+// destination while it is failing.
+func (s Service) resolveTarget(r *http.Request, link *Url) target {
+	result := target{destination: link.Original}
+	if len(link.Rules) > 0 {
+		result.rule = fallbackRule
+		if rule := matchRule(link.Rules, newVisitor(r, s.countryHeader)); rule != nil {
+			return target{destination: rule.Destination, rule: rule.Name}
+		}
+	}
+	if destination, scheduled := scheduledDestination(link.Schedule, s.now()); scheduled {
+		result.destination = destination
+		return result
+	}
+	if len(link.Variants) > 0 {
+		variant := stickyVariant(r, link)
+		if variant == nil {
+			variant = pickVariant(link.Variants, s.randomIntN)
+			result.pin = link.StickyVariants
+		}
+		if variant != nil {
+			result.destination = variant.Destination
+			result.variant = variant.Name
+		}
+	}
+	if result.destination == link.Original && s.failingOver(link) {
+		result.destination = link.Fallback
+		result.failover = true
+	} else if result.destination == link.Original && s.archivingOver(link) {
+		result.destination = link.archiveUrl()
+		result.failover = true
+		result.archived = true
+	}
+	return result
+}
+
+// recordTarget adds a visit to the breakdowns reported by the stats endpoint
+// and pins sticky variants to the visitor.
+func (s Service) recordTarget(writer http.ResponseWriter, r *http.Request, link *Url, t target) {
+	if t.rule != "" {
+		s.visits.record(link.Id, dimensionRule, t.rule)
+	}
+	if link.Fallback != "" || link.ArchiveWhenDead {
+		if t.archived {
+			s.visits.record(link.Id, dimensionFailover, "archive")
+		} else if t.failover {
+			s.visits.record(link.Id, dimensionFailover, "fallback")
+		} else if t.destination == link.Original {
+			s.visits.record(link.Id, dimensionFailover, "primary")
+		}
+	}
+	if t.variant != "" {
+		s.visits.record(link.Id, dimensionVariant, t.variant)
+		if t.pin {
+			pinVariant(writer, r, link, t.variant)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package url
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const (
+	iphoneAgent  = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1"
+	androidAgent = "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Mobile Safari/537.36"
+	desktopAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36"
+)
+
+func targetedLink() *Url {
+	return &Url{Id: 0, Original: "https://example.com", Shortened: "app", Rules: []TargetingRule{
+		{Name: "ios", Os: []string{"ios"}, Destination: "https://apps.apple.com/app/id1"},
+		{Name: "android", Os: []string{"android"}, Destination: "https://play.google.com/store/apps/details?id=app"},
+		{Name: "german", Language: []string{"de"}, Country: []string{"AT", "DE"}, Destination: "https://example.de"},
+	}}
+}
+
+func TestAcceptedLanguagesSkipsRejectedTags(t *testing.T) {
+	languages := acceptedLanguages("de-AT, en;q=0.5, fr;q=0, *")
+
+	if len(languages) != 2 || languages[0] != "de-at" || languages[1] != "en" {
+		t.Errorf("Expected [de-at en], got %v", languages)
+	}
+}
+
+func TestNormalizeRulesNamesAndValidates(t *testing.T) {
+	rules, err := normalizeRules([]TargetingRule{{Os: []string{" iOS "}, Country: []string{"de"}, Destination: "https://example.com"}})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if rules[0].Name != "rule_1" || rules[0].Os[0] != "ios" || rules[0].Country[0] != "DE" {
+		t.Errorf("Expected normalized rule, got %+v", rules[0])
+	}
+
+	if _, err := normalizeRules([]TargetingRule{{Destination: "not a url"}}); err == nil {
+		t.Errorf("Expected error for invalid destination, got nil")
+	}
+	if _, err := normalizeRules([]TargetingRule{{Name: "a", Destination: "https://a.com"}, {Name: "a", Destination: "https://b.com"}}); err == nil {
+		t.Errorf("Expected error for duplicate rule names, got nil")
+	}
+}
+
+func TestHandleUrlRedirectAppliesFirstMatchingRule(t *testing.T) {
+	service, _ := newRedirectService(targetedLink(), WithCountryHeader("CF-IPCountry"))
+
+	cases := []struct {
+		headers  map[string]string
+		expected string
+	}{
+		{map[string]string{"User-Agent": iphoneAgent}, "https://apps.apple.com/app/id1"},
+		{map[string]string{"User-Agent": androidAgent, "Accept-Language": "de", "CF-IPCountry": "DE"}, "https://play.google.com/store/apps/details?id=app"},
+		{map[string]string{"User-Agent": desktopAgent, "Accept-Language": "de-AT,en;q=0.8", "CF-IPCountry": "at"}, "https://example.de"},
+		{map[string]string{"User-Agent": desktopAgent, "Accept-Language": "de", "CF-IPCountry": "CH"}, "https://example.com"},
+	}
+	for _, c := range cases {
+		var options []requestOption
+		for key, value := range c.headers {
+			options = append(options, withHeader(key, value))
+		}
+		w := visit(t, service, "app", options...)
+		if location := w.Header().Get("Location"); location != c.expected {
+			t.Errorf("Expected %s for %v, got %s", c.expected, c.headers, location)
+		}
+	}
+}
+
+func TestHandleStatsReportsMatchedRules(t *testing.T) {
+	service, _ := newRedirectService(targetedLink(), WithCountryHeader("CF-IPCountry"))
+	visit(t, service, "app", withHeader("User-Agent", iphoneAgent))
+	visit(t, service, "app", withHeader("User-Agent", iphoneAgent))
+	visit(t, service, "app", withHeader("User-Agent", desktopAgent))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/stats/0", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "0"})
+	w := httptest.NewRecorder()
+	service.handleStats(w, req)
+
+	var result VisitResponse
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if result.Visits != 3 {
+		t.Errorf("Expected 3 visits, got %d", result.Visits)
+	}
+	if result.Breakdown["rule"]["ios"] != 2 || result.Breakdown["rule"][fallbackRule] != 1 {
+		t.Errorf("Expected visits per rule, got %v", result.Breakdown)
+	}
+}
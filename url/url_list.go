@@ -0,0 +1,282 @@
+package url
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"thesilentcoder.com/m/fetch"
+	"time"
+)
+
+const (
+	defaultListLimit = 20
+	maxListLimit     = 100
+)
+
+const (
+	sortCreated = "created"
+	sortVisits  = "visits"
+)
+
+type LinkResponse struct {
+	Id            int               `json:"id"`
+	Url           string            `json:"url"`
+	Original      string            `json:"original"`
+	Shortened     string            `json:"shortened"`
+	Visits        int               `json:"visits"`
+	Owner         string            `json:"owner,omitempty"`
+	CreatedAt     time.Time         `json:"created_at"`
+	Tags          []string          `json:"tags,omitempty"`
+	Campaign      string            `json:"campaign,omitempty"`
+	Utm           *Utm              `json:"utm,omitempty"`
+	Title         string            `json:"title,omitempty"`
+	Fallback      string            `json:"fallback,omitempty"`
+	Liveness      *LivenessResponse `json:"liveness,omitempty"`
+	Metadata      *Metadata         `json:"metadata,omitempty"`
+	RedirectChain []fetch.Hop       `json:"redirect_chain,omitempty"`
+	Snapshots     []Snapshot        `json:"snapshots,omitempty"`
+	ExpiresAt     *time.Time        `json:"expires_at,omitempty"`
+}
+
+type LivenessResponse struct {
+	LastStatus    int       `json:"last_status"`
+	LastError     string    `json:"last_error,omitempty"`
+	LastChecked   time.Time `json:"last_checked"`
+	FailureStreak int       `json:"failure_streak"`
+}
+
+type LinkListResponse struct {
+	Urls       []LinkResponse `json:"urls"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+func newLinkResponse(u *Url) LinkResponse {
+	response := LinkResponse{
+		Id:            u.Id,
+		Url:           u.Url,
+		Original:      u.Original,
+		Shortened:     u.Shortened,
+		Visits:        u.Visits,
+		Owner:         u.Owner,
+		CreatedAt:     u.CreatedAt,
+		Tags:          u.Tags,
+		Campaign:      u.Campaign,
+		Title:         u.Title,
+		Fallback:      u.Fallback,
+		RedirectChain: u.RedirectChain,
+		Snapshots:     u.Snapshots,
+	}
+	if !u.Utm.IsZero() {
+		utm := u.Utm
+		response.Utm = &utm
+	}
+	if !u.Liveness.LastChecked.IsZero() {
+		response.Liveness = &LivenessResponse{
+			LastStatus:    u.Liveness.LastStatus,
+			LastError:     u.Liveness.LastError,
+			LastChecked:   u.Liveness.LastChecked,
+			FailureStreak: u.Liveness.FailureStreak,
+		}
+	}
+	if !u.ExpiresAt.IsZero() {
+		expiresAt := u.ExpiresAt
+		response.ExpiresAt = &expiresAt
+	}
+	if !u.Metadata.FetchedAt.IsZero() {
+		metadata := u.Metadata
+		response.Metadata = &metadata
+	}
+	return response
+}
+
+// listCursor is the position of the last link on the previous page. It is
+// handed to clients base64 encoded so they treat it as opaque.
+type listCursor struct {
+	Value int64 `json:"v"`
+	Id    int   `json:"id"`
+}
+
+type listQuery struct {
+	sort       string
+	descending bool
+	limit      int
+	cursor     *listCursor
+	filter     linkFilter
+}
+
+// linkFilter selects the links a listing is made of.
+type linkFilter struct {
+	owner    string
+	domain   string
+	tag      string
+	campaign string
+	// minFailures only keeps links whose destination failed at least that
+	// many liveness probes in a row.
+	minFailures int
+}
+
+func (f linkFilter) matches(u *Url) bool {
+	if u.Owner != f.owner {
+		return false
+	}
+	if f.tag != "" && !slices.Contains(u.Tags, f.tag) {
+		return false
+	}
+	if f.campaign != "" && u.Campaign != f.campaign {
+		return false
+	}
+	if f.minFailures > 0 && u.Liveness.FailureStreak < f.minFailures {
+		return false
+	}
+	if f.domain != "" {
+		parsed, err := url.Parse(u.Original)
+		if err != nil {
+			return false
+		}
+		host := strings.ToLower(parsed.Hostname())
+		if host != f.domain && !strings.HasSuffix(host, "."+f.domain) {
+			return false
+		}
+	}
+	return true
+}
+
+func parseListQuery(values url.Values, owner string) (listQuery, error) {
+	query := listQuery{sort: sortCreated, descending: true, limit: defaultListLimit}
+	query.filter = linkFilter{owner: owner, domain: strings.ToLower(values.Get("domain")), tag: values.Get("tag"), campaign: values.Get("campaign")}
+
+	switch values.Get("sort") {
+	case "", sortCreated:
+	case sortVisits:
+		query.sort = sortVisits
+	default:
+		return query, fmt.Errorf("sort must be %s or %s", sortCreated, sortVisits)
+	}
+
+	switch values.Get("order") {
+	case "", "desc":
+	case "asc":
+		query.descending = false
+	default:
+		return query, fmt.Errorf("order must be asc or desc")
+	}
+
+	if limit := values.Get("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil || parsed < 1 || parsed > maxListLimit {
+			return query, fmt.Errorf("limit must be between 1 and %d", maxListLimit)
+		}
+		query.limit = parsed
+	}
+
+	if cursor := values.Get("cursor"); cursor != "" {
+		decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil {
+			return query, fmt.Errorf("invalid cursor")
+		}
+		query.cursor = &listCursor{}
+		if err := json.Unmarshal(decoded, query.cursor); err != nil {
+			return query, fmt.Errorf("invalid cursor")
+		}
+	}
+	return query, nil
+}
+
+func (q listQuery) sortValue(u *Url) int64 {
+	if q.sort == sortVisits {
+		return int64(u.Visits)
+	}
+	return u.CreatedAt.UnixNano()
+}
+
+// before reports whether a sorts before b, breaking ties on id so that the
+// order is total and cursors are stable.
+func (q listQuery) before(aValue int64, aId int, bValue int64, bId int) bool {
+	if aValue == bValue {
+		return aId < bId
+	}
+	if q.descending {
+		return aValue > bValue
+	}
+	return aValue < bValue
+}
+
+// page sorts and filters links and returns the page following the cursor
+// together with the cursor of the page after it.
+func (q listQuery) page(links []*Url) ([]*Url, string) {
+	var selected []*Url
+	for _, link := range links {
+		if !q.filter.matches(link) {
+			continue
+		}
+		if q.cursor != nil && !q.before(q.cursor.Value, q.cursor.Id, q.sortValue(link), link.Id) {
+			continue
+		}
+		selected = append(selected, link)
+	}
+	sort.Slice(selected, func(i, j int) bool {
+		return q.before(q.sortValue(selected[i]), selected[i].Id, q.sortValue(selected[j]), selected[j].Id)
+	})
+
+	if len(selected) <= q.limit {
+		return selected, ""
+	}
+	selected = selected[:q.limit]
+	last := selected[len(selected)-1]
+	encoded, _ := json.Marshal(listCursor{Value: q.sortValue(last), Id: last.Id})
+	return selected, base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+func (s Service) handleListUrls(writer http.ResponseWriter, r *http.Request) {
+	query, err := parseListQuery(r.URL.Query(), ownerFrom(r.Context()))
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.writeLinkList(writer, r, query)
+}
+
+// handleBrokenUrls lists the links whose destination failed the last
+// min_failures liveness probes, 1 by default. It takes the same parameters as
+// handleListUrls.
+func (s Service) handleBrokenUrls(writer http.ResponseWriter, r *http.Request) {
+	query, err := parseListQuery(r.URL.Query(), ownerFrom(r.Context()))
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	query.filter.minFailures = 1
+	if value := r.URL.Query().Get("min_failures"); value != "" {
+		query.filter.minFailures, err = strconv.Atoi(value)
+		if err != nil || query.filter.minFailures < 1 {
+			http.Error(writer, "min_failures must be a positive number", http.StatusBadRequest)
+			return
+		}
+	}
+	s.writeLinkList(writer, r, query)
+}
+
+func (s Service) writeLinkList(writer http.ResponseWriter, r *http.Request, query listQuery) {
+	links, err := s.repository.List(r.Context())
+	if err != nil {
+		http.Error(writer, "Failed to list URLs", http.StatusInternalServerError)
+		return
+	}
+
+	page, next := query.page(links)
+	response := LinkListResponse{Urls: make([]LinkResponse, 0, len(page)), NextCursor: next}
+	for _, link := range page {
+		response.Urls = append(response.Urls, newLinkResponse(link))
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(writer).Encode(response); err != nil {
+		http.Error(writer, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
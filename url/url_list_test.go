@@ -0,0 +1,180 @@
+package url
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"thesilentcoder.com/m/auth"
+	"time"
+)
+
+func newListRepository() *mockRepository {
+	repo := newMockRepository()
+	created := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	repo.urls[0] = &Url{Id: 0, Original: "https://example.com/a", Shortened: "a", Owner: "team-a", Visits: 5, CreatedAt: created}
+	repo.urls[1] = &Url{Id: 1, Original: "https://docs.example.com/b", Shortened: "b", Owner: "team-a", Visits: 1, CreatedAt: created.Add(time.Hour)}
+	repo.urls[2] = &Url{Id: 2, Original: "https://other.org/c", Shortened: "c", Owner: "team-a", Visits: 9, CreatedAt: created.Add(2 * time.Hour)}
+	repo.urls[3] = &Url{Id: 3, Original: "https://example.com/d", Shortened: "d", Owner: "team-b", Visits: 3, CreatedAt: created.Add(3 * time.Hour)}
+	return repo
+}
+
+func listAs(t *testing.T, service *Service, owner string, query string) LinkListResponse {
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/urls"+query, nil)
+	req = req.WithContext(auth.WithPrincipal(req.Context(), &auth.Principal{KeyId: "key", Owner: owner}))
+	w := httptest.NewRecorder()
+
+	service.handleListUrls(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var result LinkListResponse
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	return result
+}
+
+func shortenedOf(response LinkListResponse) []string {
+	var result []string
+	for _, link := range response.Urls {
+		result = append(result, link.Shortened)
+	}
+	return result
+}
+
+func TestHandleListUrlsReturnsOnlyCallersLinksNewestFirst(t *testing.T) {
+	service := New(newListRepository(), ":8080", "http://localhost", "api", 1)
+
+	result := shortenedOf(listAs(t, service, "team-a", ""))
+
+	if len(result) != 3 || result[0] != "c" || result[1] != "b" || result[2] != "a" {
+		t.Errorf("Expected [c b a], got %v", result)
+	}
+}
+
+func TestHandleListUrlsSortsByVisits(t *testing.T) {
+	service := New(newListRepository(), ":8080", "http://localhost", "api", 1)
+
+	result := shortenedOf(listAs(t, service, "team-a", "?sort=visits&order=asc"))
+
+	if len(result) != 3 || result[0] != "b" || result[1] != "a" || result[2] != "c" {
+		t.Errorf("Expected [b a c], got %v", result)
+	}
+}
+
+func TestHandleListUrlsFiltersByDomain(t *testing.T) {
+	service := New(newListRepository(), ":8080", "http://localhost", "api", 1)
+
+	result := shortenedOf(listAs(t, service, "team-a", "?domain=example.com"))
+
+	if len(result) != 2 || result[0] != "b" || result[1] != "a" {
+		t.Errorf("Expected [b a], got %v", result)
+	}
+}
+
+func TestHandleListUrlsPaginatesWithCursor(t *testing.T) {
+	service := New(newListRepository(), ":8080", "http://localhost", "api", 1)
+
+	first := listAs(t, service, "team-a", "?limit=2")
+	if len(first.Urls) != 2 || first.NextCursor == "" {
+		t.Fatalf("Expected a full first page with a cursor, got %+v", first)
+	}
+
+	second := listAs(t, service, "team-a", "?limit=2&cursor="+first.NextCursor)
+	result := shortenedOf(second)
+	if len(result) != 1 || result[0] != "a" {
+		t.Errorf("Expected [a] on second page, got %v", result)
+	}
+	if second.NextCursor != "" {
+		t.Errorf("Expected no cursor on last page, got %s", second.NextCursor)
+	}
+}
+
+func TestHandleListUrlsRejectsInvalidSort(t *testing.T) {
+	service := New(newListRepository(), ":8080", "http://localhost", "api", 1)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/urls?sort=name", nil)
+	w := httptest.NewRecorder()
+	service.handleListUrls(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+}
+
+func TestHandleUrlShortenRecordsOwner(t *testing.T) {
+	repo := newMockRepository()
+	service := New(repo, ":8080", "http://localhost", "api", 1)
+
+	req := newShortenRequest(t, ShortLink{Url: "https://example.com"})
+	req = req.WithContext(auth.WithPrincipal(req.Context(), &auth.Principal{KeyId: "key", Owner: "team-a"}))
+	w := httptest.NewRecorder()
+	service.handleUrlShorten(w, req)
+
+	if repo.urls[0].Owner != "team-a" {
+		t.Errorf("Expected owner 'team-a', got %q", repo.urls[0].Owner)
+	}
+	if repo.urls[0].CreatedAt.IsZero() {
+		t.Errorf("Expected creation time to be recorded")
+	}
+}
+
+func TestHandleStatsHidesOtherOwnersLinks(t *testing.T) {
+	service := New(newListRepository(), ":8080", "http://localhost", "api", 1)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/stats/3", nil)
+	req = req.WithContext(auth.WithPrincipal(req.Context(), &auth.Principal{KeyId: "key", Owner: "team-a"}))
+	req = mux.SetURLVars(req, map[string]string{"id": "3"})
+	w := httptest.NewRecorder()
+	service.handleStats(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", w.Code)
+	}
+}
+
+func TestHandleListUrlsFiltersByTag(t *testing.T) {
+	service := New(newCampaignRepository(), ":8080", "http://localhost", "api", 1)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/urls?tag=email&order=asc", nil)
+	w := httptest.NewRecorder()
+	service.handleListUrls(w, req)
+
+	var response LinkListResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	result := shortenedOf(response)
+	if len(result) != 2 || result[0] != "a" || result[1] != "c" {
+		t.Errorf("Expected [a c], got %v", result)
+	}
+}
+
+func TestHandleBrokenUrlsListsFailingLinks(t *testing.T) {
+	repo := newListRepository()
+	repo.urls[0].Liveness = Liveness{LastStatus: 404, LastChecked: time.Now(), FailureStreak: 1}
+	repo.urls[2].Liveness = Liveness{LastStatus: 0, LastError: "timeout", LastChecked: time.Now(), FailureStreak: 4}
+	repo.urls[3].Liveness = Liveness{LastStatus: 500, LastChecked: time.Now(), FailureStreak: 5}
+	service := New(repo, ":8080", "http://localhost", "api", 1)
+
+	for query, expected := range map[string]int{"": 2, "?min_failures=3": 1} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/urls/broken"+query, nil)
+		req = req.WithContext(auth.WithPrincipal(req.Context(), &auth.Principal{KeyId: "key", Owner: "team-a"}))
+		w := httptest.NewRecorder()
+		service.handleBrokenUrls(w, req)
+
+		var result LinkListResponse
+		if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if len(result.Urls) != expected {
+			t.Errorf("Expected %d broken links for %q, got %v", expected, query, shortenedOf(result))
+		}
+		if len(result.Urls) > 0 && result.Urls[0].Liveness == nil {
+			t.Errorf("Expected liveness in response")
+		}
+	}
+}
@@ -1,25 +1,102 @@
 package url
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"math/rand/v2"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
+	"thesilentcoder.com/m/auth"
+	"thesilentcoder.com/m/domainpolicy"
+	"thesilentcoder.com/m/events"
+	"thesilentcoder.com/m/fetch"
 	"thesilentcoder.com/m/repository"
+	"thesilentcoder.com/m/tracing"
+	"time"
 )
 
 type ShortLink struct {
-	Url string `json:"url"`
+	Url      string   `json:"url"`
+	Tags     []string `json:"tags,omitempty"`
+	Campaign string   `json:"campaign,omitempty"`
+	Utm
+	Passthrough
+	RedirectPolicy
+	Title            string          `json:"title,omitempty"`
+	Interstitial     bool            `json:"interstitial,omitempty"`
+	Password         string          `json:"password,omitempty"`
+	Rules            []TargetingRule `json:"rules,omitempty"`
+	Variants         []Variant       `json:"variants,omitempty"`
+	StickyVariants   bool            `json:"sticky_variants,omitempty"`
+	Schedule         []ScheduleEntry `json:"schedule,omitempty"`
+	NotBefore        string          `json:"not_before,omitempty"`
+	DeepLink         DeepLink        `json:"deep_link,omitempty"`
+	Fallback         string          `json:"fallback,omitempty"`
+	ResolveRedirects bool            `json:"resolve_redirects,omitempty"`
+	Archive          bool            `json:"archive,omitempty"`
+	ArchiveWhenDead  bool            `json:"archive_when_dead,omitempty"`
+	ExpiresAt        string          `json:"expires_at,omitempty"`
 }
 
 type Url struct {
-	Id        int
-	Original  string
-	Shortened string
-	Url       string
-	Visits    int
+	Id          int
+	Original    string
+	Shortened   string
+	Url         string
+	Visits      int
+	Owner       string
+	CreatedAt   time.Time
+	Tags        []string
+	Campaign    string
+	Utm         Utm
+	Passthrough Passthrough
+	Redirect    RedirectPolicy
+	Title       string
+	// Interstitial shows the preview page before sending visitors to an
+	// external destination.
+	Interstitial bool
+	// PasswordHash is the bcrypt hash of the password visitors have to
+	// enter, if any.
+	PasswordHash string
+	// Rules are evaluated in order on every visit, Original being the
+	// fallback when none match.
+	Rules []TargetingRule
+	// Variants split the remaining traffic by weight instead of sending it
+	// all to Original.
+	Variants       []Variant
+	StickyVariants bool
+	// Schedule overrides the destination while one of its windows is open.
+	Schedule []ScheduleWindow
+	// NotBefore is when the link starts redirecting, if set.
+	NotBefore time.Time
+	// DeepLink opens the mobile app on iOS and Android instead.
+	DeepLink DeepLink
+	// Liveness is kept up to date by the LivenessChecker.
+	Liveness Liveness
+	// Fallback replaces Original while the liveness probes keep failing.
+	Fallback string
+	// Metadata is fetched from the destination after the link is created.
+	Metadata Metadata
+	// RedirectChain is the chain that was followed to find Original, when
+	// the link was created with redirect resolution.
+	RedirectChain []fetch.Hop
+	// Archive keeps snapshots of the destination, taken by the Archiver.
+	Archive    bool
+	Snapshots  []Snapshot
+	ArchivedAt time.Time
+	// ArchiveWhenDead sends visitors to the latest snapshot while the
+	// destination is failing and there is no Fallback.
+	ArchiveWhenDead bool
+	// ExpiresAt is when the link stops redirecting, if set.
+	ExpiresAt time.Time
+	// ExpiryPublished records that the link.expired event went out.
+	ExpiryPublished bool
 }
 
 type ShortenedLink struct {
@@ -27,27 +104,84 @@ type ShortenedLink struct {
 }
 
 type VisitResponse struct {
-	Visits int `json:"visits"`
+	Visits    int                       `json:"visits"`
+	Breakdown map[string]map[string]int `json:"breakdown,omitempty"`
 }
 
-func New(repository repository.Repository[Url], port string, redirectUrl string, apiPrefix string, apiVersion int) *Service {
-	return &Service{repository, port, redirectUrl, apiPrefix, apiVersion}
+func New(repository repository.Repository[Url], port string, redirectUrl string, apiPrefix string, apiVersion int, options ...Option) *Service {
+	service := &Service{
+		repository:        repository,
+		port:              port,
+		redirectUrl:       redirectUrl,
+		apiPrefix:         apiPrefix,
+		apiVersion:        apiVersion,
+		passwords:         newPasswordGuard(),
+		visits:            newVisitStats(),
+		randomIntN:        rand.IntN,
+		location:          time.UTC,
+		now:               time.Now,
+		schemes:           defaultSchemes,
+		failoverThreshold: defaultFailoverThreshold,
+	}
+	for _, option := range options {
+		option(service)
+	}
+	return service
 }
 
 type Service struct {
-	repository  repository.Repository[Url]
-	port        string
-	redirectUrl string
-	apiPrefix   string
-	apiVersion  int
+	repository    repository.Repository[Url]
+	port          string
+	redirectUrl   string
+	apiPrefix     string
+	apiVersion    int
+	authenticator *auth.Authenticator
+	passwords     *passwordGuard
+	visits        *visitStats
+	countryHeader string
+	randomIntN    func(int) int
+	location      *time.Location
+	now           func() time.Time
+	domains       *domainpolicy.Policy
+	schemes       []string
+	// failoverThreshold is the number of failed liveness probes in a row
+	// after which visits go to a link's fallback destination.
+	failoverThreshold int
+	metadata          *metadataFetcher
+	resolver          *fetch.Client
+	archiver          *Archiver
+	publisher         events.Publisher
+	visitThresholds   []int
 }
 
 func (s Service) RegisterHandlers(router *mux.Router) {
 	formattedUrl := fmt.Sprintf("/%s/v%d/", s.apiPrefix, s.apiVersion)
-	router.HandleFunc(formattedUrl+"shorten", s.handleUrlShorten).Methods("POST")
-	router.HandleFunc("/{shortened}/", s.handleUrlRedirect).Methods("GET")
+	router.HandleFunc(formattedUrl+"shorten", tracing.Handler("url.handleUrlShorten", s.authenticator.Require(auth.ScopeLinksWrite, s.handleUrlShorten))).Methods("POST")
+	router.HandleFunc("/{shortened}+", tracing.Handler("url.handlePreview", s.handlePreview)).Methods("GET", "POST")
+	// Before the redirect route, whose passthrough would forward it.
+	router.HandleFunc("/{shortened}/"+archivePath, tracing.Handler("url.handleArchive", s.handleArchive)).Methods("GET", "HEAD", "POST")
+
+	router.HandleFunc(formattedUrl+"urls", tracing.Handler("url.handleListUrls", s.authenticator.Require(auth.ScopeLinksRead, s.handleListUrls))).Methods("GET")
+	router.HandleFunc(formattedUrl+"urls/{id}", tracing.Handler("url.handleDeleteUrl", s.authenticator.Require(auth.ScopeLinksWrite, s.handleDeleteUrl))).Methods("DELETE")
+	router.HandleFunc(formattedUrl+"urls/broken", tracing.Handler("url.handleBrokenUrls", s.authenticator.Require(auth.ScopeLinksRead, s.handleBrokenUrls))).Methods("GET")
+	router.HandleFunc(formattedUrl+"urls/{id}/metadata", tracing.Handler("url.handleRefreshMetadata", s.authenticator.Require(auth.ScopeLinksWrite, s.handleRefreshMetadata))).Methods("POST")
+	router.HandleFunc(formattedUrl+"urls/{id}/qr", tracing.Handler("url.handleQrCode", s.authenticator.Require(auth.ScopeLinksRead, s.handleQrCode))).Methods("GET")
+	router.HandleFunc(formattedUrl+"stats", tracing.Handler("url.handleAggregateStats", s.authenticator.Require(auth.ScopeStatsRead, s.handleAggregateStats))).Methods("GET")
+	router.HandleFunc(formattedUrl+"campaigns/{name}/stats", tracing.Handler("url.handleCampaignStats", s.authenticator.Require(auth.ScopeStatsRead, s.handleCampaignStats))).Methods("GET")
+	router.HandleFunc(formattedUrl+"stats/{id}", tracing.Handler("url.handleStats", s.authenticator.Require(auth.ScopeStatsRead, s.handleStats))).Methods("GET")
+
+	// Registered last, as it would also match every API path. A single route
+	// serves the link and its sub-paths: a route that matches in part after a
+	// method mismatch would turn the 405 into a 404.
+	router.NewRoute().MatcherFunc(s.outsideApi).Path("/{shortened}/{path:.*}").
+		HandlerFunc(tracing.Handler("url.handleUrlRedirect", s.handleUrlRedirect)).MatcherFunc(s.allowsMethod)
+}
 
-	router.HandleFunc(formattedUrl+"stats/{id}", s.handleStats).Methods("GET")
+// outsideApi keeps the redirect route off the API paths, so that unknown API
+// endpoints are not taken for the short link whose code is the API prefix.
+// It goes before the path so that a method mismatch of an API route is kept.
+func (s Service) outsideApi(r *http.Request, _ *mux.RouteMatch) bool {
+	return shortCodeOf(r.URL.Path) != s.apiPrefix
 }
 
 func (s Service) handleUrlShorten(writer http.ResponseWriter, r *http.Request) {
@@ -67,8 +201,111 @@ func (s Service) handleUrlShorten(writer http.ResponseWriter, r *http.Request) {
 		http.Error(writer, "Invalid URL format", http.StatusBadRequest)
 		return
 	}
+	tags, err := normalizeTags(short.Tags)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	campaign := strings.TrimSpace(short.Campaign)
+	if len(campaign) > maxLabelLength {
+		http.Error(writer, "Campaign is too long", http.StatusBadRequest)
+		return
+	}
+	title := strings.TrimSpace(short.Title)
+	if len(title) > maxTitleLength {
+		http.Error(writer, "Title is too long", http.StatusBadRequest)
+		return
+	}
+	if err := short.Passthrough.validate(); err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := short.RedirectPolicy.validate(); err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateFallback(short.Fallback); err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := short.DeepLink.validate(); err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rules, err := normalizeRules(short.Rules)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	variants, err := normalizeVariants(short.Variants)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	schedule, err := parseSchedule(short.Schedule, s.location)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var notBefore time.Time
+	if short.NotBefore != "" {
+		notBefore, err = parseTime(short.NotBefore, s.location)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	var expiresAt time.Time
+	if short.ExpiresAt != "" {
+		expiresAt, err = parseTime(short.ExpiresAt, s.location)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !expiresAt.After(s.now()) || (!notBefore.IsZero() && !expiresAt.After(notBefore)) {
+			http.Error(writer, "expires_at must be in the future and after not_before", http.StatusBadRequest)
+			return
+		}
+	}
+	archiveLink := short.Archive || short.ArchiveWhenDead
+	if archiveLink && s.archiver == nil {
+		http.Error(writer, "archiving is not enabled", http.StatusNotImplemented)
+		return
+	}
+	var passwordHash string
+	if short.Password != "" {
+		passwordHash, err = hashPassword(short.Password)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	var redirectChain []fetch.Hop
+	if short.ResolveRedirects {
+		// Nothing is fetched for a URL the link could not be created with.
+		if err := s.checkDestination(short.Url); err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+		redirectChain, err = s.resolveRedirects(r.Context(), short.Url)
+		if errors.Is(err, errResolveDisabled) {
+			http.Error(writer, err.Error(), http.StatusNotImplemented)
+			return
+		}
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+		short.Url = redirectChain[len(redirectChain)-1].Url
+	}
+	utm := short.Utm.trimmed()
+	original, err := utm.Apply(short.Url)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	next, err := s.repository.Next()
+	next, err := s.repository.Next(r.Context())
 	if err != nil {
 		http.Error(writer, "Failed to get next ID", http.StatusInternalServerError)
 		return
@@ -82,17 +319,46 @@ func (s Service) handleUrlShorten(writer http.ResponseWriter, r *http.Request) {
 
 	redirect := fmt.Sprintf("%s%s/%s", s.redirectUrl, s.port, shortened)
 	u := Url{
-		Id:        next,
-		Original:  short.Url,
-		Shortened: shortened,
-		Visits:    0,
-		Url:       redirect,
+		Id:              next,
+		Original:        original,
+		Shortened:       shortened,
+		Visits:          0,
+		Url:             redirect,
+		Owner:           ownerFrom(r.Context()),
+		CreatedAt:       s.now().UTC(),
+		Tags:            tags,
+		Campaign:        campaign,
+		Utm:             utm,
+		Passthrough:     short.Passthrough,
+		Redirect:        short.RedirectPolicy,
+		Title:           title,
+		Interstitial:    short.Interstitial,
+		PasswordHash:    passwordHash,
+		Rules:           rules,
+		Variants:        variants,
+		StickyVariants:  short.StickyVariants,
+		Schedule:        schedule,
+		NotBefore:       notBefore,
+		DeepLink:        short.DeepLink,
+		Fallback:        short.Fallback,
+		RedirectChain:   redirectChain,
+		Archive:         archiveLink,
+		ArchiveWhenDead: short.ArchiveWhenDead,
+		ExpiresAt:       expiresAt,
 	}
-	ret, err := s.repository.Insert(&u)
+	if err := s.checkDestinations(r.Context(), &u); err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ret, err := s.repository.Insert(r.Context(), &u)
 	if err != nil {
+		zerolog.Ctx(r.Context()).Error().Err(err).Msg("Failed to insert url")
 		http.Error(writer, "Failed to shorten URL", http.StatusInternalServerError)
 		return
 	}
+	s.publish(r.Context(), events.New(events.LinkCreated, eventLink(ret)))
+	s.fetchMetadataLater(r.Context(), ret.Id)
+	s.snapshotLater(r.Context(), ret)
 	writer.Header().Set("Content-Type", "application/json")
 
 	shortLink := ShortenedLink{ret.Url}
@@ -107,20 +373,73 @@ func (s Service) handleUrlRedirect(writer http.ResponseWriter, r *http.Request)
 	params := mux.Vars(r)
 	shortened := params["shortened"]
 
-	byValue, err := s.repository.GetByValue(shortened)
+	byValue, err := s.repository.GetByValue(r.Context(), shortened)
 
 	if err != nil {
 		http.Error(writer, err.Error(), http.StatusNotFound)
 		return
 	}
 
-	err = s.repository.Update(byValue)
-	if err != nil {
-		http.Error(writer, err.Error(), http.StatusInternalServerError)
+	if s.refuseUnavailable(writer, r, byValue) {
+		return
+	}
+	// Only the password form may POST to other links, and it is done.
+	if r.Method != http.MethodGet && r.Method != http.MethodHead && !byValue.Redirect.preservesMethod() {
+		http.Error(writer, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if params["path"] == archivePath {
+		http.Error(writer, "Snapshot not found", http.StatusNotFound)
+		return
+	}
+
+	target := s.resolveTarget(r, byValue)
+	previewRequested, confirmed, rawQuery := s.stripControlParams(r, byValue)
+	destination := target.destination
+	if !target.archived {
+		destination, err = byValue.Passthrough.Apply(target.destination, params["path"], rawQuery)
+		if err != nil {
+			http.Error(writer, "Invalid destination", http.StatusInternalServerError)
+			return
+		}
+	}
+	if s.refuseBlocked(writer, r, byValue, destination) ||
+		r.Method == http.MethodGet && s.refuseBlockedApp(writer, r, byValue) {
 		return
 	}
 
-	http.Redirect(writer, r, byValue.Original, http.StatusFound)
+	if r.Method == http.MethodGet {
+		if previewRequested {
+			s.renderPreview(writer, r, byValue, destination, false)
+			return
+		}
+		if byValue.Interstitial && !confirmed && s.isExternal(destination) {
+			s.renderPreview(writer, r, byValue, destination, true)
+			return
+		}
+	}
+
+	// Link checkers and unfurlers send HEAD, which is not a visit.
+	if r.Method != http.MethodHead {
+		visits, err := s.repository.Update(r.Context(), byValue)
+		if err != nil {
+			zerolog.Ctx(r.Context()).Error().Err(err).Str("short_code", shortened).Msg("Failed to record visit")
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.recordTarget(writer, r, byValue, target)
+		s.publishVisit(r, byValue, visits, target, destination)
+	}
+
+	if r.Method == http.MethodGet && s.openApp(writer, r, byValue, destination) {
+		return
+	}
+	if target.failover {
+		failoverRedirect.Redirect(writer, r, destination)
+		return
+	}
+	byValue.Redirect.Redirect(writer, r, destination)
 }
 
 func (s Service) handleStats(writer http.ResponseWriter, r *http.Request) {
@@ -131,14 +450,14 @@ func (s Service) handleStats(writer http.ResponseWriter, r *http.Request) {
 		http.Error(writer, "Invalid ID", http.StatusBadRequest)
 		return
 	}
-	res, err := s.repository.GetById(id)
+	res, err := s.repository.GetById(r.Context(), id)
 
-	if res == nil {
+	if res == nil || res.Owner != ownerFrom(r.Context()) {
 		http.Error(writer, "URL not found", http.StatusNotFound)
 		return
 	}
 
-	response := VisitResponse{Visits: res.Visits}
+	response := VisitResponse{Visits: res.Visits, Breakdown: s.visits.breakdown(res.Id)}
 
 	err = json.NewEncoder(writer).Encode(response)
 	if err != nil {
@@ -146,3 +465,26 @@ func (s Service) handleStats(writer http.ResponseWriter, r *http.Request) {
 	}
 
 }
+
+// refuseUnavailable answers visits to links that have expired, are not active
+// yet or are locked by a password the visitor has not entered. It reports
+// whether it did.
+func (s Service) refuseUnavailable(writer http.ResponseWriter, r *http.Request, link *Url) bool {
+	switch {
+	case s.expired(link):
+		http.Error(writer, "Link has expired", http.StatusGone)
+	case !link.NotBefore.IsZero() && s.now().Before(link.NotBefore):
+		s.renderNotYetAvailable(writer, r, link)
+	case link.PasswordHash != "" && !s.passwords.unlocked(r, link):
+		s.challenge(writer, r, link)
+	default:
+		return false
+	}
+	return true
+}
+
+// ownerFrom returns the owner recorded on links created by the caller. Links
+// created while authentication is disabled have no owner.
+func ownerFrom(ctx context.Context) string {
+	return auth.OwnerFrom(ctx)
+}
@@ -2,19 +2,21 @@ package url
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/gorilla/mux"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"thesilentcoder.com/m/auth"
 )
 
 type mockRepository struct {
 	urls map[int]*Url
 }
 
-func (m *mockRepository) GetById(id int) (*Url, error) {
+func (m *mockRepository) GetById(_ context.Context, id int) (*Url, error) {
 	url, exists := m.urls[id]
 	if !exists {
 		return nil, nil
@@ -22,7 +24,7 @@ func (m *mockRepository) GetById(id int) (*Url, error) {
 	return url, nil
 }
 
-func (m *mockRepository) GetByValue(value string) (*Url, error) {
+func (m *mockRepository) GetByValue(_ context.Context, value string) (*Url, error) {
 	for _, url := range m.urls {
 		if url.Shortened == value {
 			return url, nil
@@ -31,7 +33,7 @@ func (m *mockRepository) GetByValue(value string) (*Url, error) {
 	return nil, fmt.Errorf("not found")
 }
 
-func (m *mockRepository) Insert(url *Url) (*Url, error) {
+func (m *mockRepository) Insert(_ context.Context, url *Url) (*Url, error) {
 	if url.Id == -1 {
 		url.Id = len(m.urls)
 	}
@@ -39,23 +41,79 @@ func (m *mockRepository) Insert(url *Url) (*Url, error) {
 	return url, nil
 }
 
-func (m *mockRepository) Update(url *Url) error {
+func (m *mockRepository) Update(_ context.Context, url *Url) (int, error) {
 	if _, exists := m.urls[url.Id]; exists {
 		m.urls[url.Id].Visits += 1
+		return m.urls[url.Id].Visits, nil
 	}
+	return 0, nil
+}
+
+func (m *mockRepository) Modify(_ context.Context, id int, modify func(*Url)) (*Url, error) {
+	url, exists := m.urls[id]
+	if !exists {
+		return nil, fmt.Errorf("not found")
+	}
+	modify(url)
+	return url, nil
+}
+
+func (m *mockRepository) Delete(_ context.Context, id int) error {
+	if _, exists := m.urls[id]; !exists {
+		return fmt.Errorf("not found")
+	}
+	delete(m.urls, id)
 	return nil
 }
 
-func (m *mockRepository) Next() (int, error) {
+func (m *mockRepository) Next(_ context.Context) (int, error) {
 	return len(m.urls), nil
 }
 
+func (m *mockRepository) List(_ context.Context) ([]*Url, error) {
+	result := make([]*Url, 0, len(m.urls))
+	for _, url := range m.urls {
+		result = append(result, url)
+	}
+	return result, nil
+}
+
 func newMockRepository() *mockRepository {
 	return &mockRepository{
 		urls: make(map[int]*Url),
 	}
 }
 
+// newRedirectService returns a service whose repository holds link.
+func newRedirectService(link *Url, options ...Option) (*Service, *mockRepository) {
+	repo := newMockRepository()
+	repo.urls[link.Id] = link
+	return New(repo, ":8080", "http://localhost", "api", 1, options...), repo
+}
+
+type requestOption func(r *http.Request)
+
+func withHeader(key string, value string) requestOption {
+	return func(r *http.Request) { r.Header.Set(key, value) }
+}
+
+func withCookie(cookie *http.Cookie) requestOption {
+	return func(r *http.Request) { r.AddCookie(cookie) }
+}
+
+// visit sends a GET for the short link code straight to handleUrlRedirect.
+func visit(t *testing.T, service *Service, code string, options ...requestOption) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/"+code+"/", nil)
+	for _, option := range options {
+		option(req)
+	}
+	req = mux.SetURLVars(req, map[string]string{"shortened": code})
+	w := httptest.NewRecorder()
+	service.handleUrlRedirect(w, req)
+	return w
+}
+
 func TestHandleUrlShortenReturnsSuccessfulResponse(t *testing.T) {
 	repo := newMockRepository()
 	service := New(repo, ":8080", "http://localhost", "api", 1)
@@ -290,3 +348,76 @@ func TestHandleUrlShortenReturnsBadRequestForEmptyUrl(t *testing.T) {
 		t.Errorf("Expected status 400, got %d", w.Code)
 	}
 }
+
+func newAuthenticatedService(t *testing.T, repo *mockRepository) *Service {
+	authenticator, err := auth.New([]auth.Key{
+		{Id: "writer", Owner: "team-a", Hash: auth.HashKey("write-key"), Scopes: []string{auth.ScopeLinksWrite, auth.ScopeStatsRead}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create authenticator: %v", err)
+	}
+	return New(repo, ":8080", "http://localhost", "api", 1, WithAuthenticator(authenticator))
+}
+
+func TestRegisterHandlersRequiresApiKeyForShorten(t *testing.T) {
+	repo := newMockRepository()
+	router := mux.NewRouter()
+	newAuthenticatedService(t, repo).RegisterHandlers(router)
+
+	body, _ := json.Marshal(ShortLink{Url: "https://example.com"})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/shorten", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/shorten", bytes.NewBuffer(body))
+	req.Header.Set(auth.ApiKeyHeader, "write-key")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+}
+
+func TestRegisterHandlersLeavesRedirectOpen(t *testing.T) {
+	repo := newMockRepository()
+	repo.urls[1] = &Url{Id: 1, Original: "https://example.com", Shortened: "abc"}
+	router := mux.NewRouter()
+	newAuthenticatedService(t, repo).RegisterHandlers(router)
+
+	req := httptest.NewRequest(http.MethodGet, "/abc/", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusFound {
+		t.Errorf("Expected status 302, got %d", w.Code)
+	}
+}
+
+func newShortenRequest(t *testing.T, short ShortLink) *http.Request {
+	body, err := json.Marshal(short)
+	if err != nil {
+		t.Fatalf("Failed to encode request: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/shorten", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+func TestRegisterHandlersDoesNotRedirectUnknownApiPaths(t *testing.T) {
+	repo := newMockRepository()
+	repo.urls[31682] = &Url{Id: 31682, Original: "https://example.com", Shortened: "api"}
+	router := mux.NewRouter()
+	New(repo, ":8080", "http://localhost", "api", 1).RegisterHandlers(router)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/unknown", nil))
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d %s", w.Code, w.Header().Get("Location"))
+	}
+}
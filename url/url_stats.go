@@ -0,0 +1,109 @@
+package url
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+const (
+	maxTags        = 20
+	maxLabelLength = 64
+	maxTitleLength = 256
+)
+
+const noValue = "(none)"
+
+type StatsBucket struct {
+	Links  int `json:"links"`
+	Visits int `json:"visits"`
+}
+
+type AggregateStatsResponse struct {
+	StatsBucket
+	Breakdown map[string]StatsBucket `json:"breakdown,omitempty"`
+}
+
+// normalizeTags trims and de-duplicates tags while keeping their order.
+func normalizeTags(tags []string) ([]string, error) {
+	if len(tags) > maxTags {
+		return nil, fmt.Errorf("at most %d tags are allowed", maxTags)
+	}
+	var result []string
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			return nil, fmt.Errorf("tags cannot be empty")
+		}
+		if len(tag) > maxLabelLength {
+			return nil, fmt.Errorf("tag %q is too long", tag)
+		}
+		if !slices.Contains(result, tag) {
+			result = append(result, tag)
+		}
+	}
+	return result, nil
+}
+
+// aggregate sums the links matching filter, optionally broken down by one of
+// the utm_* keys.
+func (s Service) aggregate(r *http.Request, filter linkFilter, by string) (AggregateStatsResponse, error) {
+	links, err := s.repository.List(r.Context())
+	if err != nil {
+		return AggregateStatsResponse{}, err
+	}
+	var response AggregateStatsResponse
+	if by != "" {
+		response.Breakdown = make(map[string]StatsBucket)
+	}
+	for _, link := range links {
+		if !filter.matches(link) {
+			continue
+		}
+		response.Links++
+		response.Visits += link.Visits
+		if by != "" {
+			value := link.Utm.Get(by)
+			if value == "" {
+				value = noValue
+			}
+			bucket := response.Breakdown[value]
+			bucket.Links++
+			bucket.Visits += link.Visits
+			response.Breakdown[value] = bucket
+		}
+	}
+	return response, nil
+}
+
+func (s Service) writeAggregate(writer http.ResponseWriter, r *http.Request, filter linkFilter) {
+	by := r.URL.Query().Get("by")
+	if by != "" && !isUtmKey(by) {
+		http.Error(writer, fmt.Sprintf("by must be one of %s", strings.Join(utmKeys, ", ")), http.StatusBadRequest)
+		return
+	}
+
+	response, err := s.aggregate(r, filter, by)
+	if err != nil {
+		http.Error(writer, "Failed to aggregate stats", http.StatusInternalServerError)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(writer).Encode(response)
+	if err != nil {
+		http.Error(writer, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+func (s Service) handleAggregateStats(writer http.ResponseWriter, r *http.Request) {
+	s.writeAggregate(writer, r, linkFilter{owner: ownerFrom(r.Context()), tag: r.URL.Query().Get("tag")})
+}
+
+func (s Service) handleCampaignStats(writer http.ResponseWriter, r *http.Request) {
+	campaign := mux.Vars(r)["name"]
+	s.writeAggregate(writer, r, linkFilter{owner: ownerFrom(r.Context()), campaign: campaign, tag: r.URL.Query().Get("tag")})
+}
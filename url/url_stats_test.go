@@ -0,0 +1,147 @@
+package url
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newCampaignRepository() *mockRepository {
+	repo := newMockRepository()
+	repo.urls[0] = &Url{Id: 0, Original: "https://example.com/a", Shortened: "a", Visits: 5, Tags: []string{"spring", "email"}, Campaign: "launch"}
+	repo.urls[1] = &Url{Id: 1, Original: "https://example.com/b", Shortened: "b", Visits: 3, Tags: []string{"spring"}, Campaign: "launch"}
+	repo.urls[2] = &Url{Id: 2, Original: "https://example.com/c", Shortened: "c", Visits: 7, Tags: []string{"email"}, Campaign: "other"}
+	repo.urls[3] = &Url{Id: 3, Original: "https://example.com/d", Shortened: "d", Visits: 11, Campaign: "launch", Owner: "team-b"}
+	return repo
+}
+
+func decodeAggregate(t *testing.T, w *httptest.ResponseRecorder) AggregateStatsResponse {
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var result AggregateStatsResponse
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	return result
+}
+
+func TestNormalizeTagsTrimsAndDeduplicates(t *testing.T) {
+	tags, err := normalizeTags([]string{" spring ", "email", "spring"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(tags) != 2 || tags[0] != "spring" || tags[1] != "email" {
+		t.Errorf("Expected [spring email], got %v", tags)
+	}
+}
+
+func TestNormalizeTagsRejectsEmptyTag(t *testing.T) {
+	if _, err := normalizeTags([]string{" "}); err == nil {
+		t.Errorf("Expected error for empty tag, got nil")
+	}
+}
+
+func TestHandleUrlShortenStoresTagsAndCampaign(t *testing.T) {
+	repo := newMockRepository()
+	service := New(repo, ":8080", "http://localhost", "api", 1)
+
+	w := httptest.NewRecorder()
+	service.handleUrlShorten(w, newShortenRequest(t, ShortLink{Url: "https://example.com", Tags: []string{"spring"}, Campaign: " launch "}))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if len(repo.urls[0].Tags) != 1 || repo.urls[0].Tags[0] != "spring" {
+		t.Errorf("Expected tags [spring], got %v", repo.urls[0].Tags)
+	}
+	if repo.urls[0].Campaign != "launch" {
+		t.Errorf("Expected campaign 'launch', got %q", repo.urls[0].Campaign)
+	}
+}
+
+func TestHandleCampaignStatsAggregatesVisits(t *testing.T) {
+	service := New(newCampaignRepository(), ":8080", "http://localhost", "api", 1)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/campaigns/launch/stats", nil)
+	req = mux.SetURLVars(req, map[string]string{"name": "launch"})
+	w := httptest.NewRecorder()
+	service.handleCampaignStats(w, req)
+
+	result := decodeAggregate(t, w)
+	if result.Links != 2 || result.Visits != 8 {
+		t.Errorf("Expected 2 links with 8 visits, got %+v", result)
+	}
+}
+
+func TestHandleAggregateStatsFiltersByTag(t *testing.T) {
+	service := New(newCampaignRepository(), ":8080", "http://localhost", "api", 1)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/stats?tag=email", nil)
+	w := httptest.NewRecorder()
+	service.handleAggregateStats(w, req)
+
+	result := decodeAggregate(t, w)
+	if result.Links != 2 || result.Visits != 12 {
+		t.Errorf("Expected 2 links with 12 visits, got %+v", result)
+	}
+}
+
+func TestHandleAggregateStatsCoversAllLinksWithoutTag(t *testing.T) {
+	service := New(newCampaignRepository(), ":8080", "http://localhost", "api", 1)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/stats", nil)
+	w := httptest.NewRecorder()
+	service.handleAggregateStats(w, req)
+
+	result := decodeAggregate(t, w)
+	if result.Links != 3 || result.Visits != 15 {
+		t.Errorf("Expected 3 links with 15 visits, got %+v", result)
+	}
+}
+
+func TestHandleCampaignStatsBreaksDownByUtm(t *testing.T) {
+	repo := newCampaignRepository()
+	repo.urls[0].Utm = Utm{Source: "newsletter"}
+	repo.urls[1].Utm = Utm{Source: "twitter"}
+	service := New(repo, ":8080", "http://localhost", "api", 1)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/campaigns/launch/stats?by=utm_source", nil)
+	req = mux.SetURLVars(req, map[string]string{"name": "launch"})
+	w := httptest.NewRecorder()
+	service.handleCampaignStats(w, req)
+
+	result := decodeAggregate(t, w)
+	if result.Breakdown["newsletter"].Visits != 5 || result.Breakdown["twitter"].Visits != 3 {
+		t.Errorf("Expected visits per utm_source, got %+v", result.Breakdown)
+	}
+}
+
+func TestHandleAggregateStatsRejectsUnknownBreakdown(t *testing.T) {
+	service := New(newCampaignRepository(), ":8080", "http://localhost", "api", 1)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/stats?by=country", nil)
+	w := httptest.NewRecorder()
+	service.handleAggregateStats(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+}
+
+func TestRegisterHandlersRoutesCampaignStats(t *testing.T) {
+	service := New(newCampaignRepository(), ":8080", "http://localhost", "api", 1)
+	router := mux.NewRouter()
+	service.RegisterHandlers(router)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/campaigns/launch/stats?tag=spring", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	result := decodeAggregate(t, w)
+	if result.Links != 2 || result.Visits != 8 {
+		t.Errorf("Expected 2 links with 8 visits, got %+v", result)
+	}
+}
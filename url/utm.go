@@ -0,0 +1,82 @@
+package url
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Utm holds the campaign parameters that were merged into a link's
+// destination.
+type Utm struct {
+	Source   string `json:"utm_source,omitempty"`
+	Medium   string `json:"utm_medium,omitempty"`
+	Campaign string `json:"utm_campaign,omitempty"`
+	Term     string `json:"utm_term,omitempty"`
+	Content  string `json:"utm_content,omitempty"`
+}
+
+var utmKeys = []string{"utm_source", "utm_medium", "utm_campaign", "utm_term", "utm_content"}
+
+func (u Utm) IsZero() bool {
+	return u == Utm{}
+}
+
+// Get returns the value for one of the utm_* query keys.
+func (u Utm) Get(key string) string {
+	switch key {
+	case "utm_source":
+		return u.Source
+	case "utm_medium":
+		return u.Medium
+	case "utm_campaign":
+		return u.Campaign
+	case "utm_term":
+		return u.Term
+	case "utm_content":
+		return u.Content
+	}
+	return ""
+}
+
+func (u Utm) trimmed() Utm {
+	return Utm{
+		Source:   strings.TrimSpace(u.Source),
+		Medium:   strings.TrimSpace(u.Medium),
+		Campaign: strings.TrimSpace(u.Campaign),
+		Term:     strings.TrimSpace(u.Term),
+		Content:  strings.TrimSpace(u.Content),
+	}
+}
+
+// Apply merges the parameters into destination. Existing parameters and the
+// fragment are kept as they were, except for utm_* keys being set here, which
+// are replaced.
+func (u Utm) Apply(destination string) (string, error) {
+	if u.IsZero() {
+		return destination, nil
+	}
+	parsed, err := url.Parse(destination)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL: %w", err)
+	}
+
+	var pairs []string
+	for _, pair := range splitQuery(parsed.RawQuery) {
+		if u.Get(queryKey(pair)) == "" {
+			pairs = append(pairs, pair)
+		}
+	}
+	for _, key := range utmKeys {
+		if value := u.Get(key); value != "" {
+			pairs = append(pairs, key+"="+url.QueryEscape(value))
+		}
+	}
+	parsed.RawQuery = strings.Join(pairs, "&")
+	return parsed.String(), nil
+}
+
+func isUtmKey(key string) bool {
+	return slices.Contains(utmKeys, key)
+}
@@ -0,0 +1,76 @@
+package url
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUtmApplyPreservesQueryAndFragment(t *testing.T) {
+	utm := Utm{Source: "newsletter", Medium: "email"}
+
+	result, err := utm.Apply("https://example.com/page?ref=abc&x=%2F#section")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := "https://example.com/page?ref=abc&x=%2F&utm_source=newsletter&utm_medium=email#section"
+	if result != expected {
+		t.Errorf("Expected %s, got %s", expected, result)
+	}
+}
+
+func TestUtmApplyReplacesExistingUtmKeys(t *testing.T) {
+	utm := Utm{Source: "newsletter"}
+
+	result, err := utm.Apply("https://example.com/?utm_source=old&utm_medium=kept")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := "https://example.com/?utm_medium=kept&utm_source=newsletter"
+	if result != expected {
+		t.Errorf("Expected %s, got %s", expected, result)
+	}
+}
+
+func TestUtmApplyEscapesValues(t *testing.T) {
+	utm := Utm{Campaign: "spring sale & more"}
+
+	result, err := utm.Apply("https://example.com")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := "https://example.com?utm_campaign=spring+sale+%26+more"
+	if result != expected {
+		t.Errorf("Expected %s, got %s", expected, result)
+	}
+}
+
+func TestUtmApplyLeavesUrlAloneWithoutParameters(t *testing.T) {
+	result, err := Utm{}.Apply("https://example.com/?a=1#b")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if result != "https://example.com/?a=1#b" {
+		t.Errorf("Expected URL to be unchanged, got %s", result)
+	}
+}
+
+func TestHandleUrlShortenMergesUtmIntoOriginal(t *testing.T) {
+	repo := newMockRepository()
+	service := New(repo, ":8080", "http://localhost", "api", 1)
+
+	short := ShortLink{Url: "https://example.com/?ref=1", Utm: Utm{Source: " newsletter ", Campaign: "spring"}}
+	w := httptest.NewRecorder()
+	service.handleUrlShorten(w, newShortenRequest(t, short))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	stored := repo.urls[0]
+	if stored.Original != "https://example.com/?ref=1&utm_source=newsletter&utm_campaign=spring" {
+		t.Errorf("Expected UTM parameters merged into original, got %s", stored.Original)
+	}
+	if stored.Utm.Source != "newsletter" || stored.Utm.Campaign != "spring" {
+		t.Errorf("Expected structured UTM fields to be stored, got %+v", stored.Utm)
+	}
+}
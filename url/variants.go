@@ -0,0 +1,107 @@
+package url
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	maxVariants         = 20
+	maxVariantWeight    = 10000
+	variantCookiePrefix = "variant_"
+	variantCookieTtl    = 30 * 24 * time.Hour
+	dimensionVariant    = "variant"
+)
+
+// variantName is what a variant may be called; the name goes into the
+// stickiness cookie as is.
+var variantName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Variant is one of several weighted destinations traffic is split between.
+type Variant struct {
+	Name        string `json:"name,omitempty"`
+	Destination string `json:"destination"`
+	Weight      int    `json:"weight"`
+}
+
+func normalizeVariants(variants []Variant) ([]Variant, error) {
+	if len(variants) > maxVariants {
+		return nil, fmt.Errorf("at most %d variants are allowed", maxVariants)
+	}
+	var result []Variant
+	var names []string
+	for i, variant := range variants {
+		variant.Name = strings.TrimSpace(variant.Name)
+		if variant.Name == "" {
+			variant.Name = fmt.Sprintf("variant_%d", i+1)
+		}
+		if !variantName.MatchString(variant.Name) {
+			return nil, fmt.Errorf("variant name %q may only contain letters, digits, _ and -", variant.Name)
+		}
+		if slices.Contains(names, variant.Name) {
+			return nil, fmt.Errorf("variant name %q is used twice", variant.Name)
+		}
+		names = append(names, variant.Name)
+
+		if variant.Weight < 1 || variant.Weight > maxVariantWeight {
+			return nil, fmt.Errorf("variant %q must have a weight between 1 and %d", variant.Name, maxVariantWeight)
+		}
+		parsed, err := url.ParseRequestURI(variant.Destination)
+		if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			return nil, fmt.Errorf("variant %q has an invalid destination", variant.Name)
+		}
+		result = append(result, variant)
+	}
+	return result, nil
+}
+
+// pickVariant chooses a variant with probability proportional to its weight.
+func pickVariant(variants []Variant, randomIntN func(int) int) *Variant {
+	total := 0
+	for _, variant := range variants {
+		total += variant.Weight
+	}
+	if total <= 0 {
+		return nil
+	}
+	n := randomIntN(total)
+	for i := range variants {
+		if n < variants[i].Weight {
+			return &variants[i]
+		}
+		n -= variants[i].Weight
+	}
+	return nil
+}
+
+// stickyVariant returns the variant the visitor was pinned to earlier, if it
+// still exists on the link.
+func stickyVariant(r *http.Request, link *Url) *Variant {
+	cookie, err := r.Cookie(variantCookiePrefix + link.Shortened)
+	if err != nil {
+		return nil
+	}
+	for i := range link.Variants {
+		if link.Variants[i].Name == cookie.Value {
+			return &link.Variants[i]
+		}
+	}
+	return nil
+}
+
+func pinVariant(writer http.ResponseWriter, r *http.Request, link *Url, variant string) {
+	http.SetCookie(writer, &http.Cookie{
+		Name:     variantCookiePrefix + link.Shortened,
+		Value:    variant,
+		Path:     "/",
+		MaxAge:   int(variantCookieTtl.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
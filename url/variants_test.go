@@ -0,0 +1,118 @@
+package url
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func variantLink(sticky bool) *Url {
+	return &Url{Id: 0, Original: "https://example.com", Shortened: "app", StickyVariants: sticky, Variants: []Variant{
+		{Name: "a", Destination: "https://example.com/a", Weight: 3},
+		{Name: "b", Destination: "https://example.com/b", Weight: 1},
+	}}
+}
+
+// fixedPicks returns picks one by one in place of rand.IntN.
+func fixedPicks(picks ...int) func(int) int {
+	return func(int) int {
+		pick := picks[0]
+		picks = picks[1:]
+		return pick
+	}
+}
+
+func TestPickVariantHonoursWeights(t *testing.T) {
+	variants := []Variant{{Name: "a", Weight: 3}, {Name: "b", Weight: 1}}
+
+	for n, expected := range []string{"a", "a", "a", "b"} {
+		picked := pickVariant(variants, func(int) int { return n })
+		if picked.Name != expected {
+			t.Errorf("Expected %s for %d, got %s", expected, n, picked.Name)
+		}
+	}
+}
+
+func TestNormalizeVariantsRejectsInvalidWeight(t *testing.T) {
+	if _, err := normalizeVariants([]Variant{{Destination: "https://example.com", Weight: 0}}); err == nil {
+		t.Errorf("Expected error for zero weight, got nil")
+	}
+	huge := []Variant{
+		{Destination: "https://example.com/a", Weight: math.MaxInt},
+		{Destination: "https://example.com/b", Weight: math.MaxInt},
+	}
+	if _, err := normalizeVariants(huge); err == nil {
+		t.Errorf("Expected error for weights whose total overflows, got nil")
+	}
+	variants, err := normalizeVariants([]Variant{{Destination: "https://example.com", Weight: 2}})
+	if err != nil || variants[0].Name != "variant_1" {
+		t.Errorf("Expected default variant name, got %v %v", variants, err)
+	}
+}
+
+func TestHandleUrlRedirectRotatesVariants(t *testing.T) {
+	service, _ := newRedirectService(variantLink(false))
+	service.randomIntN = fixedPicks(0, 3)
+
+	if location := visit(t, service, "app").Header().Get("Location"); location != "https://example.com/a" {
+		t.Errorf("Expected variant a, got %s", location)
+	}
+	w := visit(t, service, "app")
+	if location := w.Header().Get("Location"); location != "https://example.com/b" {
+		t.Errorf("Expected variant b, got %s", location)
+	}
+	if len(w.Result().Cookies()) != 0 {
+		t.Errorf("Expected no cookie for non-sticky variants")
+	}
+}
+
+func TestHandleUrlRedirectKeepsStickyVisitorOnVariant(t *testing.T) {
+	service, _ := newRedirectService(variantLink(true))
+	service.randomIntN = fixedPicks(3)
+
+	w := visit(t, service, "app")
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Value != "b" {
+		t.Fatalf("Expected visitor to be pinned to b, got %v", cookies)
+	}
+
+	w = visit(t, service, "app", withCookie(cookies[0]))
+	if location := w.Header().Get("Location"); location != "https://example.com/b" {
+		t.Errorf("Expected sticky visitor to get b again, got %s", location)
+	}
+}
+
+func TestHandleStatsReportsVisitsPerVariant(t *testing.T) {
+	service, _ := newRedirectService(variantLink(false))
+	service.randomIntN = fixedPicks(0, 1, 3)
+	for i := 0; i < 3; i++ {
+		visit(t, service, "app")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/stats/0", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "0"})
+	w := httptest.NewRecorder()
+	service.handleStats(w, req)
+
+	var result VisitResponse
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if result.Breakdown["variant"]["a"] != 2 || result.Breakdown["variant"]["b"] != 1 {
+		t.Errorf("Expected 2 visits for a and 1 for b, got %v", result.Breakdown)
+	}
+}
+
+func TestNormalizeVariantsRejectsNamesUnfitForCookies(t *testing.T) {
+	for _, name := range []string{"a;b", "a,b", "a b", `a"b`, "ä"} {
+		if _, err := normalizeVariants([]Variant{{Name: name, Destination: "https://example.com", Weight: 1}}); err == nil {
+			t.Errorf("Expected error for variant name %q, got nil", name)
+		}
+	}
+	if _, err := normalizeVariants([]Variant{{Name: "spring-sale_2", Destination: "https://example.com", Weight: 1}}); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
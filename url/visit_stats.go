@@ -0,0 +1,50 @@
+package url
+
+import "sync"
+
+const dimensionRule = "rule"
+
+// visitStats counts visits per link broken down along dimensions such as
+// the targeting rule that matched.
+type visitStats struct {
+	mu     sync.Mutex
+	counts map[int]map[string]map[string]int
+}
+
+func newVisitStats() *visitStats {
+	return &visitStats{counts: make(map[int]map[string]map[string]int)}
+}
+
+func (v *visitStats) record(id int, dimension string, value string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	dimensions, exists := v.counts[id]
+	if !exists {
+		dimensions = make(map[string]map[string]int)
+		v.counts[id] = dimensions
+	}
+	values, exists := dimensions[dimension]
+	if !exists {
+		values = make(map[string]int)
+		dimensions[dimension] = values
+	}
+	values[value]++
+}
+
+// breakdown returns a copy of the counts recorded for a link.
+func (v *visitStats) breakdown(id int) map[string]map[string]int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	dimensions, exists := v.counts[id]
+	if !exists {
+		return nil
+	}
+	result := make(map[string]map[string]int, len(dimensions))
+	for dimension, values := range dimensions {
+		result[dimension] = make(map[string]int, len(values))
+		for value, count := range values {
+			result[dimension][value] = count
+		}
+	}
+	return result
+}
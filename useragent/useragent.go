@@ -0,0 +1,103 @@
+package useragent
+
+import "strings"
+
+const (
+	OsIos      = "ios"
+	OsAndroid  = "android"
+	OsWindows  = "windows"
+	OsMacos    = "macos"
+	OsChromeos = "chromeos"
+	OsLinux    = "linux"
+
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceDesktop = "desktop"
+	DeviceBot     = "bot"
+
+	BrowserEdge    = "edge"
+	BrowserOpera   = "opera"
+	BrowserSamsung = "samsung"
+	BrowserFirefox = "firefox"
+	BrowserChrome  = "chrome"
+	BrowserSafari  = "safari"
+
+	Other = "other"
+)
+
+var botMarkers = []string{"bot", "crawler", "spider", "slurp", "facebookexternalhit", "embedly", "preview"}
+
+// Agent is the coarse classification of a User-Agent header that link rules
+// are written against.
+type Agent struct {
+	Os      string
+	Device  string
+	Browser string
+}
+
+func Parse(userAgent string) Agent {
+	lower := strings.ToLower(userAgent)
+	return Agent{
+		Os:      parseOs(lower),
+		Device:  parseDevice(lower),
+		Browser: parseBrowser(lower),
+	}
+}
+
+func parseOs(ua string) string {
+	switch {
+	case containsAny(ua, "iphone", "ipad", "ipod"):
+		return OsIos
+	case strings.Contains(ua, "android"):
+		return OsAndroid
+	case strings.Contains(ua, "windows"):
+		return OsWindows
+	case strings.Contains(ua, "cros"):
+		return OsChromeos
+	case containsAny(ua, "macintosh", "mac os x"):
+		return OsMacos
+	case strings.Contains(ua, "linux"):
+		return OsLinux
+	}
+	return Other
+}
+
+func parseDevice(ua string) string {
+	switch {
+	case containsAny(ua, botMarkers...):
+		return DeviceBot
+	case strings.Contains(ua, "ipad") || strings.Contains(ua, "tablet") ||
+		(strings.Contains(ua, "android") && !strings.Contains(ua, "mobile")):
+		return DeviceTablet
+	case containsAny(ua, "mobi", "iphone", "ipod"):
+		return DeviceMobile
+	}
+	return DeviceDesktop
+}
+
+func parseBrowser(ua string) string {
+	switch {
+	case containsAny(ua, "edg/", "edga/", "edgios/"):
+		return BrowserEdge
+	case containsAny(ua, "opr/", "opera"):
+		return BrowserOpera
+	case strings.Contains(ua, "samsungbrowser"):
+		return BrowserSamsung
+	case containsAny(ua, "firefox/", "fxios/"):
+		return BrowserFirefox
+	case containsAny(ua, "chrome/", "crios/"):
+		return BrowserChrome
+	case strings.Contains(ua, "safari/"):
+		return BrowserSafari
+	}
+	return Other
+}
+
+func containsAny(s string, substrings ...string) bool {
+	for _, substring := range substrings {
+		if strings.Contains(s, substring) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package useragent
+
+import "testing"
+
+func TestParseClassifiesCommonAgents(t *testing.T) {
+	cases := []struct {
+		userAgent string
+		expected  Agent
+	}{
+		{
+			"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1",
+			Agent{Os: OsIos, Device: DeviceMobile, Browser: BrowserSafari},
+		},
+		{
+			"Mozilla/5.0 (iPad; CPU OS 16_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/119.0 Mobile/15E148 Safari/604.1",
+			Agent{Os: OsIos, Device: DeviceTablet, Browser: BrowserChrome},
+		},
+		{
+			"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Mobile Safari/537.36",
+			Agent{Os: OsAndroid, Device: DeviceMobile, Browser: BrowserChrome},
+		},
+		{
+			"Mozilla/5.0 (Linux; Android 13; SM-X700) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/23.0 Chrome/115.0 Safari/537.36",
+			Agent{Os: OsAndroid, Device: DeviceTablet, Browser: BrowserSamsung},
+		},
+		{
+			"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36 Edg/120.0",
+			Agent{Os: OsWindows, Device: DeviceDesktop, Browser: BrowserEdge},
+		},
+		{
+			"Mozilla/5.0 (Macintosh; Intel Mac OS X 14.1; rv:120.0) Gecko/20100101 Firefox/120.0",
+			Agent{Os: OsMacos, Device: DeviceDesktop, Browser: BrowserFirefox},
+		},
+		{
+			"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			Agent{Os: Other, Device: DeviceBot, Browser: Other},
+		},
+		{
+			"",
+			Agent{Os: Other, Device: DeviceDesktop, Browser: Other},
+		},
+	}
+	for _, c := range cases {
+		if result := Parse(c.userAgent); result != c.expected {
+			t.Errorf("Expected %+v for %q, got %+v", c.expected, c.userAgent, result)
+		}
+	}
+}
@@ -0,0 +1,485 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"thesilentcoder.com/m/events"
+	"thesilentcoder.com/m/fetch"
+	"time"
+)
+
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+
+	SignatureHeader = "X-Webhook-Signature"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+)
+
+const (
+	maxAttempts         = 8
+	initialBackoff      = 30 * time.Second
+	maxBackoff          = time.Hour
+	maxConcurrent       = 4
+	maxKeptDeliveries   = 1000
+	maxPendingPerHook   = 100
+	maxResponseExcerpt  = 1024
+	dispatchPollingTime = time.Second
+)
+
+var ErrNotFound = errors.New("not found")
+
+type Subscription struct {
+	Id    string `json:"id"`
+	Owner string `json:"owner,omitempty"`
+	Url   string `json:"url"`
+	// Events are the event types delivered, all of them when empty.
+	Events    []string  `json:"events,omitempty"`
+	Secret    string    `json:"secret"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (s Subscription) wants(event events.Event) bool {
+	return s.Owner == event.Link.Owner && (len(s.Events) == 0 || slices.Contains(s.Events, event.Type))
+}
+
+type Attempt struct {
+	Time     time.Time `json:"time"`
+	Status   int       `json:"status,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Response string    `json:"response,omitempty"`
+	Duration int64     `json:"duration_ms"`
+}
+
+type Delivery struct {
+	Id             string       `json:"id"`
+	SubscriptionId string       `json:"subscription_id"`
+	Event          events.Event `json:"event"`
+	Status         string       `json:"status"`
+	// Retries counts the failed attempts since the delivery was queued or
+	// redelivered, and sets the backoff.
+	Retries     int       `json:"retries"`
+	NextAttempt time.Time `json:"next_attempt,omitempty"`
+	Attempts    []Attempt `json:"attempts,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// state is what the dispatcher keeps in its file.
+type state struct {
+	Subscriptions []Subscription `json:"subscriptions"`
+	Deliveries    []*Delivery    `json:"deliveries"`
+}
+
+// Dispatcher queues events for the subscriptions that want them and delivers
+// them with signed POST requests, retrying with exponential backoff. The
+// subscriptions and the queue are kept in a file, so that deliveries survive a
+// restart; Run writes the queue, Publish only changes it in memory.
+type Dispatcher struct {
+	mu       sync.Mutex
+	saveMu   sync.Mutex
+	path     string
+	state    state
+	dirty    bool
+	inFlight map[string]bool
+	client   *fetch.Client
+	wake     chan struct{}
+	now      func() time.Time
+}
+
+// NewDispatcher loads the subscriptions and the queue from path, which is
+// created on the first change if it does not exist.
+func NewDispatcher(path string, client *fetch.Client) (*Dispatcher, error) {
+	d := &Dispatcher{
+		path:     path,
+		inFlight: make(map[string]bool),
+		client:   client,
+		wake:     make(chan struct{}, 1),
+		now:      time.Now,
+	}
+	content, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(content, &d.state); err != nil {
+			return nil, fmt.Errorf("failed to parse webhook state: %w", err)
+		}
+	}
+	return d, nil
+}
+
+// persist writes the state, if it changed since the last write, next to the
+// file and renames it into place. The state is copied under mu and written
+// outside of it, so that Publish never waits for the disk.
+func (d *Dispatcher) persist() error {
+	d.saveMu.Lock()
+	defer d.saveMu.Unlock()
+	d.mu.Lock()
+	if !d.dirty {
+		d.mu.Unlock()
+		return nil
+	}
+	content, err := json.Marshal(d.state)
+	d.dirty = err != nil
+	d.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := d.write(content); err != nil {
+		d.mu.Lock()
+		d.dirty = true
+		d.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (d *Dispatcher) write(content []byte) error {
+	temporary, err := os.CreateTemp(filepath.Dir(d.path), filepath.Base(d.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temporary.Name())
+	if _, err := temporary.Write(content); err != nil {
+		_ = temporary.Close()
+		return err
+	}
+	if err := temporary.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temporary.Name(), d.path)
+}
+
+func (d *Dispatcher) Subscribe(subscription Subscription) (Subscription, error) {
+	d.mu.Lock()
+	subscription.Id = uuid.NewString()
+	subscription.CreatedAt = d.now().UTC()
+	d.state.Subscriptions = append(d.state.Subscriptions, subscription)
+	d.dirty = true
+	d.mu.Unlock()
+	return subscription, d.persist()
+}
+
+func (d *Dispatcher) Subscriptions(owner string) []Subscription {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var result []Subscription
+	for _, subscription := range d.state.Subscriptions {
+		if subscription.Owner == owner {
+			result = append(result, subscription)
+		}
+	}
+	return result
+}
+
+// Unsubscribe removes a subscription together with its deliveries.
+func (d *Dispatcher) Unsubscribe(owner string, id string) error {
+	d.mu.Lock()
+	index := d.subscriptionIndex(owner, id)
+	if index < 0 {
+		d.mu.Unlock()
+		return ErrNotFound
+	}
+	d.state.Subscriptions = slices.Delete(d.state.Subscriptions, index, index+1)
+	d.state.Deliveries = slices.DeleteFunc(d.state.Deliveries, func(delivery *Delivery) bool {
+		return delivery.SubscriptionId == id
+	})
+	d.dirty = true
+	d.mu.Unlock()
+	return d.persist()
+}
+
+func (d *Dispatcher) subscriptionIndex(owner string, id string) int {
+	return slices.IndexFunc(d.state.Subscriptions, func(subscription Subscription) bool {
+		return subscription.Id == id && subscription.Owner == owner
+	})
+}
+
+// Deliveries returns the delivery log of a subscription, newest first.
+func (d *Dispatcher) Deliveries(owner string, subscriptionId string) ([]Delivery, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.subscriptionIndex(owner, subscriptionId) < 0 {
+		return nil, ErrNotFound
+	}
+	var result []Delivery
+	for i := len(d.state.Deliveries) - 1; i >= 0; i-- {
+		if delivery := d.state.Deliveries[i]; delivery.SubscriptionId == subscriptionId {
+			result = append(result, *delivery)
+		}
+	}
+	return result, nil
+}
+
+// Redeliver queues a delivery again, whatever became of it before.
+func (d *Dispatcher) Redeliver(owner string, subscriptionId string, deliveryId string) error {
+	d.mu.Lock()
+	if d.subscriptionIndex(owner, subscriptionId) < 0 {
+		d.mu.Unlock()
+		return ErrNotFound
+	}
+	index := slices.IndexFunc(d.state.Deliveries, func(delivery *Delivery) bool {
+		return delivery.Id == deliveryId && delivery.SubscriptionId == subscriptionId
+	})
+	if index < 0 {
+		d.mu.Unlock()
+		return ErrNotFound
+	}
+	delivery := d.state.Deliveries[index]
+	delivery.Status = StatusPending
+	delivery.Retries = 0
+	delivery.NextAttempt = d.now().UTC()
+	d.dirty = true
+	d.mu.Unlock()
+	d.notify()
+	return d.persist()
+}
+
+// Publish queues event in memory for every subscription that wants it, up to
+// maxPendingPerHook pending deliveries each. Events other than the lifecycle
+// events in events.Types are ignored.
+func (d *Dispatcher) Publish(ctx context.Context, event events.Event) {
+	if !slices.Contains(events.Types, event.Type) {
+		return
+	}
+	d.mu.Lock()
+	queued := false
+	now := d.now().UTC()
+	for _, subscription := range d.state.Subscriptions {
+		if !subscription.wants(event) {
+			continue
+		}
+		if d.pending(subscription.Id) >= maxPendingPerHook {
+			zerolog.Ctx(ctx).Warn().Str("subscription", subscription.Id).Str("event", event.Type).Msg("Webhook queue full, dropping event")
+			continue
+		}
+		d.state.Deliveries = append(d.state.Deliveries, &Delivery{
+			Id:             uuid.NewString(),
+			SubscriptionId: subscription.Id,
+			Event:          event,
+			Status:         StatusPending,
+			NextAttempt:    now,
+			CreatedAt:      now,
+		})
+		queued = true
+	}
+	if queued {
+		d.prune()
+		d.dirty = true
+	}
+	d.mu.Unlock()
+	if queued {
+		d.notify()
+	}
+}
+
+// pending counts the pending deliveries of a subscription. It must be called
+// with mu held.
+func (d *Dispatcher) pending(subscriptionId string) int {
+	count := 0
+	for _, delivery := range d.state.Deliveries {
+		if delivery.SubscriptionId == subscriptionId && delivery.Status == StatusPending {
+			count++
+		}
+	}
+	return count
+}
+
+// prune drops the oldest finished deliveries beyond maxKeptDeliveries. It
+// must be called with mu held.
+func (d *Dispatcher) prune() {
+	excess := len(d.state.Deliveries) - maxKeptDeliveries
+	if excess <= 0 {
+		return
+	}
+	d.state.Deliveries = slices.DeleteFunc(d.state.Deliveries, func(delivery *Delivery) bool {
+		if excess > 0 && delivery.Status != StatusPending {
+			excess--
+			return true
+		}
+		return false
+	})
+}
+
+func (d *Dispatcher) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run delivers due deliveries and writes the queue until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(dispatchPollingTime)
+	defer ticker.Stop()
+	slots := make(chan struct{}, maxConcurrent)
+	wg := sync.WaitGroup{}
+	defer d.persistLogged(ctx)
+	defer wg.Wait()
+	for {
+		d.persistLogged(ctx)
+		for _, delivery := range d.due() {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				select {
+				case slots <- struct{}{}:
+				case <-ctx.Done():
+					d.release(delivery.Id)
+					return
+				}
+				defer func() { <-slots }()
+				d.deliver(ctx, delivery)
+			}()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// due returns copies of the pending deliveries whose time has come and marks
+// them as in flight.
+func (d *Dispatcher) due() []Delivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := d.now()
+	var result []Delivery
+	for _, delivery := range d.state.Deliveries {
+		if delivery.Status == StatusPending && !d.inFlight[delivery.Id] && !now.Before(delivery.NextAttempt) {
+			d.inFlight[delivery.Id] = true
+			result = append(result, *delivery)
+		}
+	}
+	return result
+}
+
+func (d *Dispatcher) persistLogged(ctx context.Context) {
+	if err := d.persist(); err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("Failed to persist webhook deliveries")
+	}
+}
+
+func (d *Dispatcher) release(id string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.inFlight, id)
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, delivery Delivery) {
+	d.mu.Lock()
+	index := slices.IndexFunc(d.state.Subscriptions, func(subscription Subscription) bool {
+		return subscription.Id == delivery.SubscriptionId
+	})
+	var subscription Subscription
+	if index >= 0 {
+		subscription = d.state.Subscriptions[index]
+	}
+	d.mu.Unlock()
+	if index < 0 {
+		d.release(delivery.Id)
+		return
+	}
+
+	attempt := d.send(ctx, subscription, delivery)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.inFlight, delivery.Id)
+	stored := slices.IndexFunc(d.state.Deliveries, func(candidate *Delivery) bool {
+		return candidate.Id == delivery.Id
+	})
+	if stored < 0 {
+		return
+	}
+	current := d.state.Deliveries[stored]
+	current.Attempts = append(current.Attempts, attempt)
+	switch {
+	case attempt.Error == "" && attempt.Status >= 200 && attempt.Status < 300:
+		current.Status = StatusDelivered
+		current.NextAttempt = time.Time{}
+	case current.Retries+1 >= maxAttempts:
+		current.Retries++
+		current.Status = StatusFailed
+		current.NextAttempt = time.Time{}
+	default:
+		current.NextAttempt = attempt.Time.Add(backoff(current.Retries))
+		current.Retries++
+	}
+	d.dirty = true
+}
+
+// backoff is the wait after the given number of earlier failures, doubling
+// from initialBackoff up to maxBackoff.
+func backoff(retries int) time.Duration {
+	wait := initialBackoff
+	for i := 0; i < retries && wait < maxBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, maxBackoff)
+}
+
+func (d *Dispatcher) send(ctx context.Context, subscription Subscription, delivery Delivery) Attempt {
+	started := d.now()
+	attempt := Attempt{Time: started.UTC()}
+	body, err := json.Marshal(delivery.Event)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.Url, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, delivery.Event.Type)
+	req.Header.Set(DeliveryHeader, delivery.Id)
+	req.Header.Set(SignatureHeader, Sign(subscription.Secret, started.Unix(), body))
+
+	// A redirect would send the signed event to wherever the receiver
+	// points it; it counts as a failed attempt instead.
+	response, err := d.client.DoWithoutRedirects(req)
+	attempt.Duration = d.now().Sub(started).Milliseconds()
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer response.Body.Close()
+	excerpt, _ := io.ReadAll(io.LimitReader(response.Body, maxResponseExcerpt))
+	attempt.Status = response.StatusCode
+	attempt.Response = string(excerpt)
+	return attempt
+}
+
+// Sign returns the signature header for body sent at timestamp: the unix
+// timestamp and the hex HMAC-SHA256 of "<timestamp>.<body>" keyed with the
+// subscription secret. Receivers recompute it to check that a delivery is
+// genuine, and reject old timestamps to stop replays.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return fmt.Sprintf("t=%d,sha256=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
@@ -0,0 +1,282 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"thesilentcoder.com/m/events"
+	"thesilentcoder.com/m/fetch"
+	"time"
+)
+
+func newTestDispatcher(t *testing.T) *Dispatcher {
+	dispatcher, err := NewDispatcher(filepath.Join(t.TempDir(), "webhooks.json"), fetch.New(fetch.Config{AllowPrivateNetworks: true}))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return dispatcher
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSignIsVerifiableWithTheSecret(t *testing.T) {
+	signature := Sign("secret", 1700000000, []byte(`{"a":1}`))
+	if !strings.HasPrefix(signature, "t=1700000000,sha256=") {
+		t.Errorf("Expected timestamp and sha256 parts, got %s", signature)
+	}
+	if signature != Sign("secret", 1700000000, []byte(`{"a":1}`)) {
+		t.Errorf("Expected signing to be deterministic")
+	}
+	if signature == Sign("other", 1700000000, []byte(`{"a":1}`)) {
+		t.Errorf("Expected a different secret to change the signature")
+	}
+	if signature == Sign("secret", 1700000001, []byte(`{"a":1}`)) {
+		t.Errorf("Expected a different timestamp to change the signature")
+	}
+}
+
+func TestDeliversSignedEventsToMatchingSubscriptions(t *testing.T) {
+	var mu sync.Mutex
+	var received []*http.Request
+	var bodies [][]byte
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		received = append(received, r)
+		bodies = append(bodies, body)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	dispatcher := newTestDispatcher(t)
+	subscription, _ := dispatcher.Subscribe(Subscription{Owner: "acme", Url: server.URL, Events: []string{events.LinkCreated}, Secret: "secret"})
+	_, _ = dispatcher.Subscribe(Subscription{Owner: "other", Url: server.URL, Secret: "secret"})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go dispatcher.Run(ctx)
+
+	dispatcher.Publish(ctx, events.New(events.LinkDeleted, events.Link{Id: 1, Owner: "acme"}))
+	dispatcher.Publish(ctx, events.New(events.LinkCreated, events.Link{Id: 1, Owner: "acme"}))
+
+	waitFor(t, func() bool {
+		deliveries, _ := dispatcher.Deliveries("acme", subscription.Id)
+		return len(deliveries) == 1 && deliveries[0].Status == StatusDelivered
+	})
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 1 {
+		t.Fatalf("Expected 1 delivery, got %d", len(received))
+	}
+	r := received[0]
+	if r.Header.Get(EventHeader) != events.LinkCreated {
+		t.Errorf("Expected event header %s, got %s", events.LinkCreated, r.Header.Get(EventHeader))
+	}
+	timestamp, _, _ := strings.Cut(strings.TrimPrefix(r.Header.Get(SignatureHeader), "t="), ",")
+	seconds, _ := strconv.ParseInt(timestamp, 10, 64)
+	if r.Header.Get(SignatureHeader) != Sign("secret", seconds, bodies[0]) {
+		t.Errorf("Expected a valid signature, got %s", r.Header.Get(SignatureHeader))
+	}
+	var event events.Event
+	if err := json.Unmarshal(bodies[0], &event); err != nil || event.Type != events.LinkCreated {
+		t.Errorf("Expected the event as body, got %s", bodies[0])
+	}
+}
+
+func TestRetriesFailedDeliveriesWithBackoff(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, r *http.Request) {
+		writer.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	dispatcher := newTestDispatcher(t)
+	subscription, _ := dispatcher.Subscribe(Subscription{Url: server.URL, Secret: "secret"})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go dispatcher.Run(ctx)
+	dispatcher.Publish(ctx, events.New(events.LinkCreated, events.Link{Id: 1}))
+
+	waitFor(t, func() bool {
+		deliveries, _ := dispatcher.Deliveries("", subscription.Id)
+		return len(deliveries) == 1 && len(deliveries[0].Attempts) == 1
+	})
+	deliveries, _ := dispatcher.Deliveries("", subscription.Id)
+	delivery := deliveries[0]
+	if delivery.Status != StatusPending || delivery.Retries != 1 {
+		t.Errorf("Expected a pending retry, got %s after %d retries", delivery.Status, delivery.Retries)
+	}
+	if delivery.Attempts[0].Status != http.StatusInternalServerError {
+		t.Errorf("Expected the attempt to record status 500, got %d", delivery.Attempts[0].Status)
+	}
+	if wait := delivery.NextAttempt.Sub(delivery.Attempts[0].Time); wait != initialBackoff {
+		t.Errorf("Expected the retry after %v, got %v", initialBackoff, wait)
+	}
+}
+
+func TestBackoffDoublesUpToTheCap(t *testing.T) {
+	if backoff(0) != 30*time.Second || backoff(1) != time.Minute || backoff(3) != 4*time.Minute {
+		t.Errorf("Expected doubling backoff, got %v %v %v", backoff(0), backoff(1), backoff(3))
+	}
+	if backoff(20) != maxBackoff {
+		t.Errorf("Expected backoff capped at %v, got %v", maxBackoff, backoff(20))
+	}
+}
+
+func TestGivesUpAfterMaxAttempts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, r *http.Request) {
+		writer.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	dispatcher := newTestDispatcher(t)
+	subscription, _ := dispatcher.Subscribe(Subscription{Url: server.URL, Secret: "secret"})
+	dispatcher.Publish(context.Background(), events.New(events.LinkCreated, events.Link{Id: 1}))
+	for range maxAttempts {
+		for _, delivery := range dispatcher.due() {
+			dispatcher.deliver(context.Background(), delivery)
+		}
+		dispatcher.mu.Lock()
+		dispatcher.state.Deliveries[0].NextAttempt = time.Time{}
+		dispatcher.mu.Unlock()
+	}
+
+	deliveries, _ := dispatcher.Deliveries("", subscription.Id)
+	if deliveries[0].Status != StatusFailed || len(deliveries[0].Attempts) != maxAttempts {
+		t.Errorf("Expected failure after %d attempts, got %s after %d", maxAttempts, deliveries[0].Status, len(deliveries[0].Attempts))
+	}
+	if len(dispatcher.due()) != 0 {
+		t.Errorf("Expected a failed delivery not to be retried")
+	}
+
+	if err := dispatcher.Redeliver("", subscription.Id, deliveries[0].Id); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if due := dispatcher.due(); len(due) != 1 || due[0].Retries != 0 {
+		t.Errorf("Expected redelivery to queue the delivery afresh, got %v", due)
+	}
+}
+
+func TestStateSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "webhooks.json")
+	client := fetch.New(fetch.Config{})
+	dispatcher, _ := NewDispatcher(path, client)
+	subscription, _ := dispatcher.Subscribe(Subscription{Owner: "acme", Url: "https://example.com/hook", Secret: "secret"})
+	dispatcher.Publish(context.Background(), events.New(events.LinkCreated, events.Link{Id: 1, Owner: "acme"}))
+	if err := dispatcher.persist(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	restarted, err := NewDispatcher(path, client)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if subscriptions := restarted.Subscriptions("acme"); len(subscriptions) != 1 || subscriptions[0].Secret != "secret" {
+		t.Errorf("Expected the subscription to be restored, got %v", subscriptions)
+	}
+	if deliveries, _ := restarted.Deliveries("acme", subscription.Id); len(deliveries) != 1 || deliveries[0].Status != StatusPending {
+		t.Errorf("Expected the pending delivery to be restored, got %v", deliveries)
+	}
+}
+
+func TestUnsubscribeIsScopedToOwner(t *testing.T) {
+	dispatcher := newTestDispatcher(t)
+	subscription, _ := dispatcher.Subscribe(Subscription{Owner: "acme", Url: "https://example.com/hook", Secret: "secret"})
+
+	if err := dispatcher.Unsubscribe("other", subscription.Id); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound for another owner, got %v", err)
+	}
+	if err := dispatcher.Unsubscribe("acme", subscription.Id); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if subscriptions := dispatcher.Subscriptions("acme"); len(subscriptions) != 0 {
+		t.Errorf("Expected no subscriptions, got %v", subscriptions)
+	}
+}
+
+func TestVisitsAreNotQueued(t *testing.T) {
+	dispatcher := newTestDispatcher(t)
+	subscription, _ := dispatcher.Subscribe(Subscription{Url: "https://example.com/hook", Secret: "secret"})
+
+	dispatcher.Publish(context.Background(), events.New(events.LinkVisited, events.Link{Id: 1}))
+
+	if deliveries, _ := dispatcher.Deliveries("", subscription.Id); len(deliveries) != 0 {
+		t.Errorf("Expected no deliveries for visits, got %d", len(deliveries))
+	}
+}
+
+func TestRedirectsAreNotFollowed(t *testing.T) {
+	var redirected atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/elsewhere" {
+			redirected.Add(1)
+			return
+		}
+		http.Redirect(writer, r, "/elsewhere", http.StatusTemporaryRedirect)
+	}))
+	defer server.Close()
+
+	dispatcher := newTestDispatcher(t)
+	subscription, _ := dispatcher.Subscribe(Subscription{Url: server.URL, Secret: "secret"})
+	dispatcher.Publish(context.Background(), events.New(events.LinkCreated, events.Link{Id: 1}))
+	for _, delivery := range dispatcher.due() {
+		dispatcher.deliver(context.Background(), delivery)
+	}
+
+	deliveries, _ := dispatcher.Deliveries("", subscription.Id)
+	if deliveries[0].Status != StatusPending || deliveries[0].Attempts[0].Status != http.StatusTemporaryRedirect {
+		t.Errorf("Expected the redirect to count as a failed attempt, got %s %+v", deliveries[0].Status, deliveries[0].Attempts)
+	}
+	if redirected.Load() != 0 {
+		t.Errorf("Expected the event not to be sent on to the redirect target")
+	}
+}
+
+func TestPublishLeavesTheFileToRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "webhooks.json")
+	dispatcher, _ := NewDispatcher(path, fetch.New(fetch.Config{}))
+	_, _ = dispatcher.Subscribe(Subscription{Url: "https://example.com/hook", Secret: "secret"})
+	before, _ := os.ReadFile(path)
+
+	dispatcher.Publish(context.Background(), events.New(events.LinkCreated, events.Link{Id: 1}))
+
+	if after, _ := os.ReadFile(path); string(after) != string(before) {
+		t.Errorf("Expected Publish not to write the file")
+	}
+	// Not due yet, so that Run only writes the file.
+	dispatcher.now = func() time.Time { return time.Now().Add(-time.Hour) }
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	dispatcher.Run(ctx)
+	if after, _ := os.ReadFile(path); !strings.Contains(string(after), events.LinkCreated) {
+		t.Errorf("Expected Run to write the queued delivery, got %s", after)
+	}
+}
+
+func TestPublishCapsPendingDeliveriesPerSubscription(t *testing.T) {
+	dispatcher := newTestDispatcher(t)
+	subscription, _ := dispatcher.Subscribe(Subscription{Url: "https://example.com/hook", Secret: "secret"})
+
+	for i := range maxPendingPerHook + 5 {
+		dispatcher.Publish(context.Background(), events.New(events.LinkCreated, events.Link{Id: i}))
+	}
+
+	if deliveries, _ := dispatcher.Deliveries("", subscription.Id); len(deliveries) != maxPendingPerHook {
+		t.Errorf("Expected %d pending deliveries, got %d", maxPendingPerHook, len(deliveries))
+	}
+}
@@ -0,0 +1,157 @@
+package webhook
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	neturl "net/url"
+	"slices"
+	"thesilentcoder.com/m/auth"
+	"thesilentcoder.com/m/events"
+	"thesilentcoder.com/m/tracing"
+)
+
+const (
+	maxSecretLength = 256
+	secretBytes     = 32
+)
+
+// Service is the management API for webhook subscriptions and their delivery
+// logs.
+type Service struct {
+	dispatcher    *Dispatcher
+	apiPrefix     string
+	apiVersion    int
+	authenticator *auth.Authenticator
+}
+
+func New(dispatcher *Dispatcher, apiPrefix string, apiVersion int, authenticator *auth.Authenticator) *Service {
+	return &Service{
+		dispatcher:    dispatcher,
+		apiPrefix:     apiPrefix,
+		apiVersion:    apiVersion,
+		authenticator: authenticator,
+	}
+}
+
+type SubscriptionRequest struct {
+	Url    string   `json:"url"`
+	Events []string `json:"events,omitempty"`
+	Secret string   `json:"secret,omitempty"`
+}
+
+func (s Service) RegisterHandlers(router *mux.Router) {
+	formattedUrl := fmt.Sprintf("/%s/v%d/", s.apiPrefix, s.apiVersion)
+	router.HandleFunc(formattedUrl+"webhooks", tracing.Handler("webhook.handleSubscribe", s.authenticator.Require(auth.ScopeWebhooksWrite, s.handleSubscribe))).Methods("POST")
+	router.HandleFunc(formattedUrl+"webhooks", tracing.Handler("webhook.handleListSubscriptions", s.authenticator.Require(auth.ScopeWebhooksRead, s.handleListSubscriptions))).Methods("GET")
+	router.HandleFunc(formattedUrl+"webhooks/{id}", tracing.Handler("webhook.handleUnsubscribe", s.authenticator.Require(auth.ScopeWebhooksWrite, s.handleUnsubscribe))).Methods("DELETE")
+	router.HandleFunc(formattedUrl+"webhooks/{id}/deliveries", tracing.Handler("webhook.handleDeliveries", s.authenticator.Require(auth.ScopeWebhooksRead, s.handleDeliveries))).Methods("GET")
+	router.HandleFunc(formattedUrl+"webhooks/{id}/deliveries/{delivery}/redeliver", tracing.Handler("webhook.handleRedeliver", s.authenticator.Require(auth.ScopeWebhooksWrite, s.handleRedeliver))).Methods("POST")
+}
+
+func (s Service) handleSubscribe(writer http.ResponseWriter, r *http.Request) {
+	var request SubscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	parsed, err := neturl.Parse(request.Url)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		http.Error(writer, "url must be an absolute http or https URL", http.StatusBadRequest)
+		return
+	}
+	for _, eventType := range request.Events {
+		if !slices.Contains(events.Types, eventType) {
+			http.Error(writer, fmt.Sprintf("Unknown event %q", eventType), http.StatusBadRequest)
+			return
+		}
+	}
+	if len(request.Secret) > maxSecretLength {
+		http.Error(writer, "Secret is too long", http.StatusBadRequest)
+		return
+	}
+	secret := request.Secret
+	if secret == "" {
+		random := make([]byte, secretBytes)
+		if _, err := rand.Read(random); err != nil {
+			http.Error(writer, "Failed to generate secret", http.StatusInternalServerError)
+			return
+		}
+		secret = hex.EncodeToString(random)
+	}
+
+	subscription, err := s.dispatcher.Subscribe(Subscription{
+		Owner:  auth.OwnerFrom(r.Context()),
+		Url:    request.Url,
+		Events: request.Events,
+		Secret: secret,
+	})
+	if err != nil {
+		http.Error(writer, "Failed to save subscription", http.StatusInternalServerError)
+		return
+	}
+	// The secret is only ever shown here.
+	writeJSON(writer, http.StatusCreated, subscription)
+}
+
+func (s Service) handleListSubscriptions(writer http.ResponseWriter, r *http.Request) {
+	subscriptions := s.dispatcher.Subscriptions(auth.OwnerFrom(r.Context()))
+	for i := range subscriptions {
+		subscriptions[i].Secret = ""
+	}
+	if subscriptions == nil {
+		subscriptions = []Subscription{}
+	}
+	writeJSON(writer, http.StatusOK, subscriptions)
+}
+
+func (s Service) handleUnsubscribe(writer http.ResponseWriter, r *http.Request) {
+	err := s.dispatcher.Unsubscribe(auth.OwnerFrom(r.Context()), mux.Vars(r)["id"])
+	if errors.Is(err, ErrNotFound) {
+		http.Error(writer, "Webhook not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(writer, "Failed to delete subscription", http.StatusInternalServerError)
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+func (s Service) handleDeliveries(writer http.ResponseWriter, r *http.Request) {
+	deliveries, err := s.dispatcher.Deliveries(auth.OwnerFrom(r.Context()), mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(writer, "Webhook not found", http.StatusNotFound)
+		return
+	}
+	if deliveries == nil {
+		deliveries = []Delivery{}
+	}
+	writeJSON(writer, http.StatusOK, deliveries)
+}
+
+func (s Service) handleRedeliver(writer http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	err := s.dispatcher.Redeliver(auth.OwnerFrom(r.Context()), vars["id"], vars["delivery"])
+	if errors.Is(err, ErrNotFound) {
+		http.Error(writer, "Delivery not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(writer, "Failed to queue delivery", http.StatusInternalServerError)
+		return
+	}
+	writer.WriteHeader(http.StatusAccepted)
+}
+
+func writeJSON(writer http.ResponseWriter, status int, value any) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	if err := json.NewEncoder(writer).Encode(value); err != nil {
+		return
+	}
+}
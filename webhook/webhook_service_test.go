@@ -0,0 +1,122 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"thesilentcoder.com/m/auth"
+	"thesilentcoder.com/m/events"
+)
+
+func newTestRouter(t *testing.T, authenticator *auth.Authenticator) (*mux.Router, *Dispatcher) {
+	dispatcher := newTestDispatcher(t)
+	router := mux.NewRouter()
+	New(dispatcher, "api", 1, authenticator).RegisterHandlers(router)
+	return router, dispatcher
+}
+
+func TestSubscribeReturnsGeneratedSecretOnce(t *testing.T) {
+	router, _ := newTestRouter(t, nil)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/webhooks", strings.NewReader(`{"url":"https://example.com/hook","events":["link.created"]}`)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var created Subscription
+	_ = json.NewDecoder(w.Body).Decode(&created)
+	if len(created.Secret) != 2*secretBytes || created.Id == "" {
+		t.Errorf("Expected an id and a generated secret, got %+v", created)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/webhooks", nil))
+	var listed []Subscription
+	_ = json.NewDecoder(w.Body).Decode(&listed)
+	if len(listed) != 1 || listed[0].Secret != "" {
+		t.Errorf("Expected the listing without the secret, got %+v", listed)
+	}
+}
+
+func TestSubscribeValidatesRequest(t *testing.T) {
+	router, _ := newTestRouter(t, nil)
+	for _, body := range []string{
+		`{"url":"ftp://example.com"}`,
+		`{"url":"/relative"}`,
+		`{"url":"https://example.com","events":["link.unknown"]}`,
+		`{"url":"https://example.com","secret":"` + strings.Repeat("s", maxSecretLength+1) + `"}`,
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/webhooks", strings.NewReader(body)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %s, got %d", body, w.Code)
+		}
+	}
+}
+
+func TestDeliveryLogAndRedelivery(t *testing.T) {
+	router, dispatcher := newTestRouter(t, nil)
+	subscription, _ := dispatcher.Subscribe(Subscription{Url: "https://example.com/hook", Secret: "secret"})
+	dispatcher.Publish(context.Background(), events.New(events.LinkCreated, events.Link{Id: 1}))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/webhooks/"+subscription.Id+"/deliveries", nil))
+	var deliveries []Delivery
+	_ = json.NewDecoder(w.Body).Decode(&deliveries)
+	if w.Code != http.StatusOK || len(deliveries) != 1 {
+		t.Fatalf("Expected 1 delivery, got %d %v", w.Code, deliveries)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/webhooks/"+subscription.Id+"/deliveries/"+deliveries[0].Id+"/redeliver", nil))
+	if w.Code != http.StatusAccepted {
+		t.Errorf("Expected status 202, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/webhooks/"+subscription.Id+"/deliveries/missing/redeliver", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", w.Code)
+	}
+}
+
+func TestWebhooksAreScopedToOwner(t *testing.T) {
+	authenticator, err := auth.New([]auth.Key{
+		{Id: "a", Hash: auth.HashKey("key-a"), Owner: "acme", Scopes: []string{auth.ScopeWebhooksRead, auth.ScopeWebhooksWrite}},
+		{Id: "b", Hash: auth.HashKey("key-b"), Owner: "other", Scopes: []string{auth.ScopeWebhooksRead, auth.ScopeWebhooksWrite}},
+		{Id: "c", Hash: auth.HashKey("key-c"), Owner: "acme", Scopes: []string{auth.ScopeWebhooksRead}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	router, dispatcher := newTestRouter(t, authenticator)
+	subscription, _ := dispatcher.Subscribe(Subscription{Owner: "acme", Url: "https://example.com/hook", Secret: "secret"})
+
+	r := httptest.NewRequest(http.MethodDelete, "/api/v1/webhooks/"+subscription.Id, nil)
+	r.Header.Set(auth.ApiKeyHeader, "key-c")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 without webhooks:write, got %d", w.Code)
+	}
+
+	r = httptest.NewRequest(http.MethodDelete, "/api/v1/webhooks/"+subscription.Id, nil)
+	r.Header.Set(auth.ApiKeyHeader, "key-b")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for another owner, got %d", w.Code)
+	}
+
+	r = httptest.NewRequest(http.MethodDelete, "/api/v1/webhooks/"+subscription.Id, nil)
+	r.Header.Set(auth.ApiKeyHeader, "key-a")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", w.Code)
+	}
+}
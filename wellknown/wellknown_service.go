@@ -0,0 +1,56 @@
+package wellknown
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"os"
+)
+
+const (
+	AppleAppSiteAssociationPath = "/.well-known/apple-app-site-association"
+	AssetLinksPath              = "/.well-known/assetlinks.json"
+)
+
+// Service serves the files iOS and Android fetch to verify that the domain
+// may open links in an app. Files that are not configured are not served.
+type Service struct {
+	files map[string][]byte
+}
+
+// New reads the apple-app-site-association and assetlinks.json files. Either
+// path may be empty.
+func New(appleAppSiteAssociationFile string, assetLinksFile string) (*Service, error) {
+	s := &Service{files: make(map[string][]byte)}
+	for path, filePath := range map[string]string{
+		AppleAppSiteAssociationPath: appleAppSiteAssociationFile,
+		AssetLinksPath:              assetLinksFile,
+	} {
+		if filePath == "" {
+			continue
+		}
+		content, err := os.ReadFile(filePath)
+		if err != nil {
+			return nil, err
+		}
+		if !json.Valid(content) {
+			return nil, fmt.Errorf("%s is not valid JSON", filePath)
+		}
+		s.files[path] = content
+	}
+	return s, nil
+}
+
+func (s Service) RegisterHandlers(mux *mux.Router) {
+	for path, content := range s.files {
+		mux.HandleFunc(path, serveJson(content)).Methods("GET", "HEAD")
+	}
+}
+
+func serveJson(content []byte) http.HandlerFunc {
+	return func(writer http.ResponseWriter, _ *http.Request) {
+		writer.Header().Set("Content-Type", "application/json")
+		_, _ = writer.Write(content)
+	}
+}
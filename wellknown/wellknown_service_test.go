@@ -0,0 +1,46 @@
+package wellknown
+
+import (
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestServesConfiguredFiles(t *testing.T) {
+	assetLinks := filepath.Join(t.TempDir(), "assetlinks.json")
+	if err := os.WriteFile(assetLinks, []byte(`[{"relation":["delegate_permission/common.handle_all_urls"]}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	service, err := New("", assetLinks)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	router := mux.NewRouter()
+	service.RegisterHandlers(router)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, AssetLinksPath, nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Expected JSON with status 200, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, AppleAppSiteAssociationPath, nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected unconfigured file to be missing, got %d", w.Code)
+	}
+}
+
+func TestNewRejectsInvalidJson(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "apple-app-site-association")
+	if err := os.WriteFile(file, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := New(file, ""); err == nil {
+		t.Errorf("Expected an error for invalid JSON")
+	}
+}